@@ -0,0 +1,33 @@
+//go:build !windows
+// +build !windows
+
+package fsutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// LockSupported reports whether files can be locked on this platform.
+const LockSupported = true
+
+// TryLock takes an exclusive lock on f without blocking. It returns false if
+// another process holds the lock.
+func TryLock(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Lock takes an exclusive lock on f, waiting for other processes to release
+// it.
+func Lock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+func Unlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
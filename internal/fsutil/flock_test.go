@@ -0,0 +1,50 @@
+package fsutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTryLock(t *testing.T) {
+	if !LockSupported {
+		t.Skip("file locking is not supported")
+	}
+
+	dir, err := ioutil.TempDir("", "fsutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	open := func() *os.File {
+		f, err := os.OpenFile(filepath.Join(dir, "lock"), os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return f
+	}
+
+	a, b := open(), open()
+	defer a.Close()
+	defer b.Close()
+
+	if ok, err := TryLock(a); !ok || err != nil {
+		t.Fatalf("TryLock = %v, %v, want true", ok, err)
+	}
+
+	if ok, err := TryLock(b); ok || err != nil {
+		t.Errorf("TryLock while locked = %v, %v, want false", ok, err)
+	}
+
+	if err := Unlock(a); err != nil {
+		t.Fatalf("Unlock error: %v", err)
+	}
+
+	if ok, err := TryLock(b); !ok || err != nil {
+		t.Errorf("TryLock after Unlock = %v, %v, want true", ok, err)
+	}
+}
@@ -0,0 +1,22 @@
+package fsutil
+
+import (
+	"errors"
+	"os"
+)
+
+const LockSupported = false
+
+var errLockUnsupported = errors.New("file locking is not supported on windows")
+
+func TryLock(f *os.File) (bool, error) {
+	return false, errLockUnsupported
+}
+
+func Lock(f *os.File) error {
+	return errLockUnsupported
+}
+
+func Unlock(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,73 @@
+// Package fsutil holds the file helpers shared by the file backed stores.
+package fsutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic writes data to a temp file next to path and renames it
+// over path, so readers never see a partially written file.
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return fmt.Errorf("create temp file error: %v", err)
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write temp file error: %v", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write temp file error: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("rename temp file error: %v", err)
+	}
+
+	return nil
+}
+
+// LockFile opens path, creating it if needed, and takes an exclusive lock on
+// it. Closing the file releases the lock.
+func LockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open lock file error: %v", err)
+	}
+
+	if err := Lock(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock file error: %v", err)
+	}
+
+	return f, nil
+}
+
+// TryLockFile is like LockFile, but returns nil without waiting if another
+// process holds the lock.
+func TryLockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open lock file error: %v", err)
+	}
+
+	ok, err := TryLock(f)
+	if !ok {
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("lock file error: %v", err)
+		}
+
+		return nil, nil
+	}
+
+	return f, nil
+}
@@ -0,0 +1,42 @@
+package fsutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+	for _, data := range []string{`{"v":1}`, `{"v":2}`} {
+		if err := WriteFileAtomic(path, []byte(data)); err != nil {
+			t.Fatalf("WriteFileAtomic error: %v", err)
+		}
+
+		got, err := ioutil.ReadFile(path)
+		if err != nil || string(got) != data {
+			t.Fatalf("ReadFile = %q, %v, want %q", got, err, data)
+		}
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		t.Errorf("dir has %d files, want 1. Temp files left behind", len(files))
+	}
+
+	if err := WriteFileAtomic(filepath.Join(dir, "missing", "state.json"), nil); err == nil {
+		t.Error("WriteFileAtomic to a missing dir succeeded")
+	}
+}
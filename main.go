@@ -5,25 +5,38 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/pragkent/hydra-wework/server"
+	"github.com/pragkent/hydra-wework/wework"
 )
 
 func main() {
-	cfg, version := parseFlags()
+	cfg, version, args := parseFlags()
 
 	if version {
 		fmt.Print(Version())
 		return
 	}
 
-	if err := run(cfg); err != nil {
+	var err error
+	switch {
+	case len(args) == 0:
+		err = run(cfg)
+	case args[0] == "whois":
+		err = whois(cfg, args[1:])
+	default:
+		err = fmt.Errorf("Unknown command %q", args[0])
+	}
+
+	if err != nil {
 		glog.Exitf("%v", err)
 	}
 }
 
-func parseFlags() (*server.Config, bool) {
+func parseFlags() (*server.Config, bool, []string) {
 	cfg := &server.Config{}
 	var fs = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 
@@ -35,7 +48,57 @@ func parseFlags() (*server.Config, bool) {
 	fs.StringVar(&cfg.WeworkCorpID, "wework-corp-id", "", "wework corp id")
 	fs.StringVar(&cfg.WeworkAgentID, "wework-agent-id", "", "wework agent id")
 	fs.StringVar(&cfg.WeworkSecret, "wework-secret", "", "wework secret")
+	fs.StringVar(&cfg.WeworkContactsSecret, "wework-contacts-secret", "", "wework contacts sync secret, used to read the directory")
+	fs.StringVar(&cfg.WeworkAPIURL, "wework-api-url", wework.DefaultBaseURL, "wework api base url")
+	fs.DurationVar(&cfg.WeworkTimeout, "wework-timeout", 10*time.Second, "wework api request timeout")
+	fs.IntVar(&cfg.WeworkMaxRetries, "wework-max-retries", wework.DefaultRetryPolicy.MaxRetries, "max retries of wework api calls failing with retryable errors")
+	fs.IntVar(&cfg.WeworkRateLimit, "wework-rate-limit", wework.DefaultRateLimit, "max wework api calls per minute to each endpoint, 0 for unlimited")
+	fs.Var((*intMap)(&cfg.WeworkEndpointRateLimits), "wework-endpoint-rate-limits", "comma separated api=limit pairs overriding -wework-rate-limit, e.g. user/get=600,message/send=300")
+	fs.StringVar(&cfg.WeworkOAuthScope, "wework-oauth-scope", wework.ScopeBase, "wework oauth scope, snsapi_base or snsapi_privateinfo")
+	fs.StringVar(&cfg.WeworkApprovalSecret, "wework-approval-secret", "", "wework approval app secret, used to submit access requests")
+	fs.DurationVar(&cfg.WeworkVisibleRangeTTL, "wework-visible-range-ttl", wework.DefaultVisibleRangeTTL, "how long the visible range of the app is cached")
+	fs.DurationVar(&cfg.DirectorySyncInterval, "directory-sync-interval", 0, "interval of full directory syncs, 0 to read profiles live")
+	fs.StringVar(&cfg.DirectorySnapshot, "directory-snapshot", "", "file the directory replica is saved to")
+	fs.DurationVar(&cfg.DirectoryMaxStaleness, "directory-max-staleness", 2*time.Hour, "max age of the directory replica read on sign-in")
+	fs.StringVar(&cfg.WeworkCallbackToken, "wework-callback-token", "", "wework callback token, enables the events endpoint")
+	fs.StringVar(&cfg.WeworkCallbackAESKey, "wework-callback-aes-key", "", "wework callback EncodingAESKey")
+	fs.StringVar(&cfg.WeworkTokenDir, "wework-token-dir", "", "directory to share wework access tokens between replicas")
+	fs.Float64Var(&cfg.WeworkTokenRatio, "wework-token-refresh-ratio", wework.DefaultTokenRefreshRatio, "fraction of access token lifetime after which it is renewed")
+	fs.StringVar(&cfg.WeworkProviderSecret, "wework-provider-secret", "", "wework service provider secret, enables provider mode")
+	fs.StringVar(&cfg.WeworkSuiteID, "wework-suite-id", "", "wework suite id")
+	fs.StringVar(&cfg.WeworkSuiteSecret, "wework-suite-secret", "", "wework suite secret")
+	fs.StringVar(&cfg.WeworkSuiteCallbackToken, "wework-suite-callback-token", "", "wework suite callback token, enables the suite events endpoint")
+	fs.StringVar(&cfg.WeworkSuiteCallbackAESKey, "wework-suite-callback-aes-key", "", "wework suite callback EncodingAESKey")
+	fs.Var((*stringMap)(&cfg.WeworkPermanentCodes), "wework-permanent-codes", "comma separated corpid=permanent_code pairs of corps authorized for the suite")
+	fs.BoolVar(&cfg.LoginPage, "login-page", false, "serve a login page embedding the wework login panel, instead of redirecting to wework")
+	fs.StringVar(&cfg.LoginLang, "login-lang", "zh", "language of the wework login panel, zh or en")
+	fs.StringVar(&cfg.LoginStylesheet, "login-stylesheet", "", "https url of a custom stylesheet for the wework login panel")
 	fs.BoolVar(&cfg.HTTPS, "https", true, "use https")
+	fs.BoolVar(&cfg.ExternalLogin, "external-login", false, "let non-members sign in under an external:<openid> subject")
+	fs.Var((*stringList)(&cfg.ExternalLoginClients), "external-login-clients", "comma separated hydra client ids external users may consent to")
+	fs.BoolVar(&cfg.SecondaryVerify, "secondary-verify", false, "host the wework secondary verification page at /wework/verify")
+	fs.Var((*stringList)(&cfg.VerifyEmailDomains), "verify-email-domains", "comma separated email domains new members must have")
+	fs.Var((*intList)(&cfg.VerifyDepartments), "verify-departments", "comma separated department ids new members must be in or below")
+	fs.BoolVar(&cfg.VerifyApproval, "verify-approval", false, "queue new members for approval by an admin")
+	fs.StringVar(&cfg.VerifyRequestDir, "verify-request-dir", "", "directory join requests awaiting approval are recorded in")
+	fs.Var((*stringMap)(&cfg.ClientGroups), "client-groups", "comma separated client=group pairs of hydra clients requiring a warden group")
+	fs.BoolVar(&cfg.AccessRequests, "access-requests", false, "let members request the group of a client through a wework approval")
+	fs.StringVar(&cfg.AccessTemplateID, "access-template-id", "", "wework approval template id of access requests")
+	fs.StringVar(&cfg.AccessTemplateControl, "access-template-control", "", "id of the textarea control of the approval template holding the request details")
+	fs.DurationVar(&cfg.AccessPollInterval, "access-poll-interval", 5*time.Minute, "interval of polling pending access requests")
+	fs.StringVar(&cfg.AccessRequestDir, "access-request-dir", "", "directory access requests are recorded in, shared by replicas")
+	fs.DurationVar(&cfg.ReviewInterval, "review-interval", 0, "interval of access reviews by department leaders, e.g. 2160h for quarterly, 0 to disable")
+	fs.DurationVar(&cfg.ReviewDeadline, "review-deadline", 7*24*time.Hour, "time leaders have to complete a review before it is escalated")
+	fs.Var((*stringList)(&cfg.ReviewGroups), "review-groups", "comma separated hydra warden groups to review, the client groups if empty")
+	fs.StringVar(&cfg.ReviewSecret, "review-secret", "", "secret signing the review links")
+	fs.StringVar(&cfg.ReviewFile, "review-file", "", "file access reviews are recorded in")
+	fs.StringVar(&cfg.PublicHost, "public-host", "", "host the adapter is reached at, used in links sent in wework")
+	fs.BoolVar(&cfg.PeopleAPI, "people-api", false, "serve the people search at /api/people")
+	fs.StringVar(&cfg.PeopleScope, "people-scope", "wework.people", "scope access tokens need for the people search")
+	fs.DurationVar(&cfg.PeopleTTL, "people-ttl", 10*time.Minute, "how long members listed for the people search are cached without the directory replica")
+	fs.StringVar(&cfg.AdminToken, "admin-token", "", "bearer token of the admin endpoints")
+	fs.Var((*stringList)(&cfg.NotifyLoginClients), "notify-login-clients", "comma separated hydra client ids whose sign-ins are notified to the user in wework")
+	fs.Var((*stringList)(&cfg.TrustedProxies), "trusted-proxies", "comma separated addresses or cidrs of the reverse proxies trusted to report the client address")
 
 	version := fs.Bool("version", false, "version")
 	verbosity := fs.Int("v", 0, "log verbvosity level")
@@ -43,7 +106,116 @@ func parseFlags() (*server.Config, bool) {
 	fs.Parse(os.Args[1:])
 
 	initLogging(*verbosity)
-	return cfg, *version
+	return cfg, *version, fs.Args()
+}
+
+// stringList is a flag.Value holding a comma separated list.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = nil
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+
+	return nil
+}
+
+// intList is a flag.Value holding a comma separated list of integers.
+type intList []int
+
+func (l *intList) String() string {
+	var s []string
+	for _, n := range *l {
+		s = append(s, strconv.Itoa(n))
+	}
+
+	return strings.Join(s, ",")
+}
+
+func (l *intList) Set(s string) error {
+	*l = nil
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+
+		*l = append(*l, n)
+	}
+
+	return nil
+}
+
+// stringMap is a flag.Value holding comma separated key=value pairs.
+type stringMap map[string]string
+
+func (m *stringMap) String() string {
+	var pairs []string
+	for k, v := range *m {
+		pairs = append(pairs, k+"="+v)
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (m *stringMap) Set(s string) error {
+	*m = make(map[string]string)
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("invalid pair %q", p)
+		}
+
+		(*m)[kv[0]] = kv[1]
+	}
+
+	return nil
+}
+
+// intMap is a flag.Value holding comma separated key=integer pairs.
+type intMap map[string]int
+
+func (m *intMap) String() string {
+	var pairs []string
+	for k, v := range *m {
+		pairs = append(pairs, k+"="+strconv.Itoa(v))
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (m *intMap) Set(s string) error {
+	var pairs stringMap
+	if err := pairs.Set(s); err != nil {
+		return err
+	}
+
+	*m = make(map[string]int)
+	for k, v := range pairs {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid pair %q: %v", k+"="+v, err)
+		}
+
+		(*m)[k] = n
+	}
+
+	return nil
 }
 
 func initLogging(verbosity int) {
@@ -64,6 +236,8 @@ func run(cfg *server.Config) error {
 		return err
 	}
 
+	defer srv.Close()
+
 	if err := srv.ListenAndServe(); err != nil {
 		return fmt.Errorf("ListenAndServe failed: %v", err)
 	}
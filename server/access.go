@@ -0,0 +1,432 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/ory/hydra/sdk/go/hydra/swagger"
+	"github.com/pragkent/hydra-wework/internal/fsutil"
+	"github.com/pragkent/hydra-wework/wework"
+)
+
+const (
+	pathAccessRequests = "/wework/access/requests"
+
+	maxAccessReasonLength = 500
+)
+
+var errNoApprover = errors.New("No department leader to approve the request")
+
+var accessDeniedTemplate = template.Must(template.New("access").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Access denied</title>
+<style>
+body { font-family: sans-serif; text-align: center; margin-top: 48px; color: #333; }
+textarea { width: 320px; height: 96px; }
+</style>
+</head>
+<body>
+<h2>Access denied</h2>
+<p>You need to be in the group {{.Group}} to sign in to {{.ClientName}}.</p>
+{{if .Pending}}
+<p>Your request for access is waiting for approval.</p>
+{{else}}
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="consent" value="{{.ConsentID}}">
+<input type="hidden" name="token" value="{{.Token}}">
+<p><textarea name="reason" maxlength="500" placeholder="Why do you need access?" required></textarea></p>
+<p><button type="submit">Request access</button></p>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+type accessDeniedPage struct {
+	Group      string
+	ClientName string
+	ConsentID  string
+	Token      string
+	Action     string
+	Pending    bool
+}
+
+// SetAccessRequestStore replaces the store access requests are recorded in,
+// if they are enabled. It must be called before ListenAndServe.
+func (s *Server) SetAccessRequestStore(store AccessRequestStore) {
+	if s.access != nil {
+		s.access = store
+	}
+}
+
+// denyGroup handles users lacking the group the client requires. Members
+// are shown a page to request access if access requests are enabled, and
+// consent is rejected otherwise.
+func (s *Server) denyGroup(w http.ResponseWriter, r *http.Request, request *swagger.OAuth2ConsentRequest, id *identity, group string) {
+	if s.access == nil || id.CorpID != "" || id.external() {
+		s.rejectConsent(w, r, request, denialReason(errGroupRequired))
+		return
+	}
+
+	pending, err := s.pendingAccess(id.UserID, request.ClientId)
+	if err != nil {
+		glog.Errorf("Load access requests failed. %v", err)
+		http.Error(w, "Load access requests error", http.StatusInternalServerError)
+		return
+	}
+
+	page := &accessDeniedPage{
+		Group:      group,
+		ClientName: firstOf(s.clientName(request.Id), request.ClientId),
+		ConsentID:  request.Id,
+		Token:      s.accessToken(id, request.Id),
+		Action:     pathAccessRequests,
+		Pending:    pending != nil,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+
+	if err := accessDeniedTemplate.Execute(w, page); err != nil {
+		glog.Errorf("Render access denied page failed. %v", err)
+	}
+}
+
+// AccessRequestHandler submits the access request posted from the denial
+// page as a wework approval.
+func (s *Server) AccessRequestHandler(w http.ResponseWriter, r *http.Request) {
+	id := loadIdentity(s.session(r))
+	if id == nil || id.CorpID != "" || id.external() {
+		renderMessage(w, http.StatusUnauthorized, "Not signed in", "Sign in to the client again to request access.")
+		return
+	}
+
+	consent := r.PostFormValue("consent")
+	if !hmac.Equal([]byte(s.accessToken(id, consent)), []byte(r.PostFormValue("token"))) {
+		renderMessage(w, http.StatusForbidden, "Request expired", "Sign in to the client again to request access.")
+		return
+	}
+
+	request, response, err := s.hcli.GetOAuth2ConsentRequest(consent)
+	if err != nil || response.StatusCode != http.StatusOK {
+		glog.Errorf("Get consent request failed. %v", err)
+		renderMessage(w, http.StatusBadRequest, "Request expired", "Sign in to the client again to request access.")
+		return
+	}
+
+	group := s.cfg.ClientGroups[request.ClientId]
+	if group == "" {
+		renderMessage(w, http.StatusBadRequest, "Access not requestable", "The client does not require a group.")
+		return
+	}
+
+	reason := strings.TrimSpace(r.PostFormValue("reason"))
+	if reason == "" {
+		renderMessage(w, http.StatusBadRequest, "Reason missing", "Tell your leader why you need access.")
+		return
+	}
+
+	if len([]rune(reason)) > maxAccessReasonLength {
+		reason = string([]rune(reason)[:maxAccessReasonLength])
+	}
+
+	claimed, err := s.access.Claim(id.UserID, request.ClientId)
+	if err != nil {
+		glog.Errorf("Claim access request failed. %v", err)
+		http.Error(w, "Load access requests error", http.StatusInternalServerError)
+		return
+	}
+
+	if !claimed {
+		renderMessage(w, http.StatusOK, "Access requested", "Your request for access is waiting for approval.")
+		return
+	}
+
+	defer func() {
+		if err := s.access.Release(id.UserID, request.ClientId); err != nil {
+			glog.Errorf("Release access request claim failed. %v", err)
+		}
+	}()
+
+	req, err := s.requestAccess(r.Context(), id, request.ClientId, group, reason)
+	if err == errNoApprover {
+		renderMessage(w, http.StatusForbidden, "No approver", "Your department has no leader to approve the request. Contact your administrator.")
+		return
+	}
+
+	if err != nil {
+		glog.Errorf("Request access for %v failed. %v", id.UserID, err)
+		http.Error(w, "Request access error", weworkErrorStatus(err))
+		return
+	}
+
+	glog.Infof("Wework user %v requested group %v for client %v. Approval %v", req.UserID, req.Group, req.ClientID, req.SpNo)
+	renderMessage(w, http.StatusOK, "Access requested",
+		"Your request was sent to "+strings.Join(req.Approvers, ", ")+" for approval. You will be notified in WeCom of the outcome.")
+}
+
+// accessToken returns the token the denial page for consent posts back, so
+// that other sites cannot request access on behalf of the signed in user.
+func (s *Server) accessToken(id *identity, consent string) string {
+	mac := hmac.New(sha256.New, []byte(s.cfg.CookieSecret))
+	fmt.Fprintf(mac, "access\n%s\n%s", id.subject(), consent)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// requestAccess submits an approval for uid to join group and records it.
+// The request must be claimed in the store.
+func (s *Server) requestAccess(ctx context.Context, id *identity, clientID, group, reason string) (*AccessRequest, error) {
+	u, err := s.getActiveUser(ctx, s.wcli, id)
+	if err != nil {
+		return nil, err
+	}
+
+	approvers, err := s.leadersOf(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.wcli.ApplyEventContext(ctx, &wework.ApplyEventRequest{
+		CreatorUserID: u.UserID,
+		TemplateID:    s.cfg.AccessTemplateID,
+		Approvers:     []wework.Approver{{Attr: wework.ApproverAny, UserIDs: approvers}},
+		ApplyData: wework.ApplyData{
+			Contents: []wework.ApplyContent{
+				wework.NewTextApplyContent("Textarea", s.cfg.AccessTemplateControl, accessRequestText(clientID, group, reason)),
+			},
+		},
+		SummaryList: []wework.ApprovalSummary{
+			wework.NewApprovalSummary("Client: " + clientID),
+			wework.NewApprovalSummary("Group: " + group),
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	req := &AccessRequest{
+		SpNo:      resp.SpNo,
+		UserID:    u.UserID,
+		Subject:   id.subject(),
+		ClientID:  clientID,
+		Group:     group,
+		Reason:    reason,
+		Approvers: approvers,
+		Status:    AccessPending,
+		CreatedAt: time.Now(),
+	}
+
+	if err := s.access.Save(req); err != nil {
+		return nil, fmt.Errorf("save access request %v error: %v", req.SpNo, err)
+	}
+
+	return req, nil
+}
+
+func accessRequestText(clientID, group, reason string) string {
+	return fmt.Sprintf("Client: %s\nGroup: %s\nReason: %s", clientID, group, reason)
+}
+
+// leadersOf returns the leaders of the main department of u, or of the
+// closest department above it that has leaders other than u. Users with no
+// such department fall back to their direct leaders.
+func (s *Server) leadersOf(ctx context.Context, u *wework.User) ([]string, error) {
+	deptID := u.MainDepartment
+	if deptID == 0 && len(u.Department) > 0 {
+		deptID = u.Department[0]
+	}
+
+	for deptID != 0 {
+		dept, err := s.wcli.GetDepartmentContext(ctx, deptID)
+		if err != nil {
+			return nil, err
+		}
+
+		var leaders []string
+		for _, uid := range dept.Leaders {
+			if uid != u.UserID {
+				leaders = append(leaders, uid)
+			}
+		}
+
+		if len(leaders) > 0 {
+			return leaders, nil
+		}
+
+		if dept.ParentID == dept.ID {
+			break
+		}
+
+		deptID = dept.ParentID
+	}
+
+	if len(u.DirectLeader) > 0 {
+		return u.DirectLeader, nil
+	}
+
+	return nil, errNoApprover
+}
+
+// pendingAccess returns the pending request of uid for clientID, or nil.
+func (s *Server) pendingAccess(uid, clientID string) (*AccessRequest, error) {
+	reqs, err := s.access.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, req := range reqs {
+		if req.UserID == uid && req.ClientID == clientID {
+			return req, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// handleApprovalChange decides access requests as their approvals change.
+func (s *Server) handleApprovalChange(ctx context.Context, ev *wework.Event) {
+	if ev.IsApprovalChange() {
+		s.decideAccess(ctx, ev.ApprovalInfo.SpNo, ev.ApprovalInfo.SpStatus)
+	}
+}
+
+// pollAccessRequests checks pending requests every AccessPollInterval, in
+// case approval events are missed or not configured.
+func (s *Server) pollAccessRequests() {
+	ticker := time.NewTicker(s.cfg.AccessPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+		}
+
+		s.pollAccessRequestsOnce()
+	}
+}
+
+// pollAccessRequestsOnce checks pending requests unless another replica
+// sharing AccessRequestDir is, so that approvals are not polled once per
+// replica.
+func (s *Server) pollAccessRequestsOnce() {
+	lock, err := fsutil.TryLockFile(filepath.Join(s.cfg.AccessRequestDir, ".poll"))
+	if err != nil {
+		glog.Errorf("Lock access request poll failed. %v", err)
+		return
+	}
+
+	if lock == nil {
+		glog.V(1).Infof("Access requests are being polled by another replica")
+		return
+	}
+
+	defer lock.Close()
+	s.checkAccessRequests()
+}
+
+func (s *Server) checkAccessRequests() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.AccessPollInterval)
+	defer cancel()
+
+	reqs, err := s.access.Pending()
+	if err != nil {
+		glog.Errorf("Load access requests failed. %v", err)
+		return
+	}
+
+	for _, req := range reqs {
+		resp, err := s.wcli.GetApprovalDetailContext(ctx, req.SpNo)
+		if err != nil {
+			glog.Errorf("Get approval %v failed. %v", req.SpNo, err)
+			continue
+		}
+
+		s.decideAccess(ctx, req.SpNo, resp.Info.SpStatus)
+	}
+}
+
+// decideAccess applies the outcome of approval spNo to its access request.
+// The request is decided in the store first, so that only one replica
+// applies it. Approved members are then added to the group, and requests
+// failing to be applied are put back to pending, to retry on the next poll.
+func (s *Server) decideAccess(ctx context.Context, spNo string, status wework.ApprovalStatus) {
+	if status == wework.ApprovalPending {
+		return
+	}
+
+	decision := AccessRejected
+	if status == wework.ApprovalApproved {
+		decision = AccessGranted
+	}
+
+	req, err := s.access.Decide(spNo, decision)
+	if err != nil {
+		glog.Errorf("Decide access request %v failed. %v", spNo, err)
+		return
+	}
+
+	if req == nil {
+		return
+	}
+
+	if req.Status == AccessGranted {
+		if err := s.addGroupMember(req.Group, req.Subject); err != nil {
+			glog.Errorf("Add %v to group %v failed. %v", req.Subject, req.Group, err)
+
+			req.Status = AccessPending
+			req.DecidedAt = time.Time{}
+			if err := s.access.Save(req); err != nil {
+				glog.Errorf("Put access request %v back to pending failed. %v", spNo, err)
+			}
+
+			return
+		}
+	}
+
+	glog.Infof("Access of wework user %v to group %v %v. Approval %v", req.UserID, req.Group, req.Status, spNo)
+	s.notifyAccess(ctx, req)
+}
+
+func (s *Server) addGroupMember(group, subject string) error {
+	response, err := s.hcli.AddMembersToGroup(group, swagger.GroupMembers{Members: []string{subject}})
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("add group members unexpected http status: %v", response.Status)
+	}
+
+	return nil
+}
+
+// notifyAccess messages the requester the outcome of req.
+func (s *Server) notifyAccess(ctx context.Context, req *AccessRequest) {
+	content := fmt.Sprintf("Your request for access to %s was rejected.", req.ClientID)
+	if req.Status == AccessGranted {
+		content = fmt.Sprintf("Your request for access to %s was approved. Sign in again to use it.", req.ClientID)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	if _, err := s.wcli.SendMessageContext(ctx, wework.NewTextMessage(content, req.UserID)); err != nil {
+		glog.Errorf("Send access notification to %v failed. %v", req.UserID, err)
+	}
+}
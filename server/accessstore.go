@@ -0,0 +1,380 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pragkent/hydra-wework/internal/fsutil"
+)
+
+// accessClaimTTL is how long a claim to submit a request holds, in case the
+// replica holding it dies before releasing it.
+const accessClaimTTL = 5 * time.Minute
+
+// AccessStatus is the state of an access request.
+type AccessStatus string
+
+const (
+	AccessPending  AccessStatus = "pending"
+	AccessGranted  AccessStatus = "granted"
+	AccessRejected AccessStatus = "rejected"
+)
+
+// AccessRequest is a request of a member to join the hydra group a client
+// requires, submitted as a wework approval numbered SpNo.
+type AccessRequest struct {
+	SpNo      string       `json:"sp_no"`
+	UserID    string       `json:"userid"`
+	Subject   string       `json:"subject"`
+	ClientID  string       `json:"client_id"`
+	Group     string       `json:"group"`
+	Reason    string       `json:"reason,omitempty"`
+	Approvers []string     `json:"approvers,omitempty"`
+	Status    AccessStatus `json:"status"`
+	CreatedAt time.Time    `json:"created_at"`
+	DecidedAt time.Time    `json:"decided_at"`
+}
+
+// AccessRequestStore records access requests. Stores may be shared by
+// replicas, whose changes they serialize.
+type AccessRequestStore interface {
+	// Save creates or updates req.
+	Save(req *AccessRequest) error
+
+	// Get returns the request of approval spNo, or nil if there is none.
+	Get(spNo string) (*AccessRequest, error)
+
+	// Pending returns the requests awaiting a decision, oldest first.
+	Pending() ([]*AccessRequest, error)
+
+	// Claim reserves submitting a request of uid for clientID. It returns
+	// false if one is pending or being submitted already. Claims expire
+	// after accessClaimTTL.
+	Claim(uid, clientID string) (bool, error)
+
+	// Release drops the claim of uid for clientID, once its request is saved
+	// or failed to be submitted.
+	Release(uid, clientID string) error
+
+	// Decide moves the pending request of approval spNo to status and
+	// returns it, or nil if it is not pending, e.g. because a replica
+	// decided it first.
+	Decide(spNo string, status AccessStatus) (*AccessRequest, error)
+}
+
+type memoryAccessRequestStore struct {
+	mu       *sync.Mutex
+	requests map[string]AccessRequest
+	claims   map[string]time.Time
+}
+
+// NewMemoryAccessRequestStore returns an AccessRequestStore keeping requests
+// in memory. Requests are lost on restart and not shared between replicas,
+// so it is only fit for tests.
+func NewMemoryAccessRequestStore() AccessRequestStore {
+	return &memoryAccessRequestStore{
+		mu:       &sync.Mutex{},
+		requests: make(map[string]AccessRequest),
+		claims:   make(map[string]time.Time),
+	}
+}
+
+func (s *memoryAccessRequestStore) Save(req *AccessRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests[req.SpNo] = *req
+	return nil
+}
+
+func (s *memoryAccessRequestStore) Get(spNo string) (*AccessRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, ok := s.requests[spNo]
+	if !ok {
+		return nil, nil
+	}
+
+	return &req, nil
+}
+
+func (s *memoryAccessRequestStore) Pending() ([]*AccessRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pendingLocked(), nil
+}
+
+func (s *memoryAccessRequestStore) pendingLocked() []*AccessRequest {
+	var reqs []*AccessRequest
+	for _, req := range s.requests {
+		if req.Status == AccessPending {
+			req := req
+			reqs = append(reqs, &req)
+		}
+	}
+
+	sortAccessRequests(reqs)
+	return reqs
+}
+
+func (s *memoryAccessRequestStore) Claim(uid, clientID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := uid + "\n" + clientID
+	if t, ok := s.claims[key]; ok && time.Since(t) < accessClaimTTL {
+		return false, nil
+	}
+
+	if hasAccessRequest(s.pendingLocked(), uid, clientID) {
+		return false, nil
+	}
+
+	s.claims[key] = time.Now()
+	return true, nil
+}
+
+func (s *memoryAccessRequestStore) Release(uid, clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.claims, uid+"\n"+clientID)
+	return nil
+}
+
+func (s *memoryAccessRequestStore) Decide(spNo string, status AccessStatus) (*AccessRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, ok := s.requests[spNo]
+	if !ok || req.Status != AccessPending {
+		return nil, nil
+	}
+
+	req.Status = status
+	req.DecidedAt = time.Now()
+	s.requests[spNo] = req
+	return &req, nil
+}
+
+type fileAccessRequestStore struct {
+	dir string
+}
+
+// NewFileAccessRequestStore returns an AccessRequestStore keeping one file
+// per request in dir, which replicas may share. Decided requests are moved
+// to dir/decided, so that listing pending requests does not read them all.
+// Changes are serialized with a lock on dir/.lock.
+func NewFileAccessRequestStore(dir string) (AccessRequestStore, error) {
+	for _, d := range []string{filepath.Join(dir, decidedAccessDir), filepath.Join(dir, accessClaimDir)} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			return nil, fmt.Errorf("create access request dir error: %v", err)
+		}
+	}
+
+	return &fileAccessRequestStore{dir: dir}, nil
+}
+
+const (
+	decidedAccessDir = "decided"
+	accessClaimDir   = "claims"
+)
+
+func (s *fileAccessRequestStore) pendingPath(spNo string) string {
+	return filepath.Join(s.dir, accessFileName(spNo)+".json")
+}
+
+func (s *fileAccessRequestStore) decidedPath(spNo string) string {
+	return filepath.Join(s.dir, decidedAccessDir, accessFileName(spNo)+".json")
+}
+
+func (s *fileAccessRequestStore) claimPath(uid, clientID string) string {
+	return filepath.Join(s.dir, accessClaimDir, accessFileName(uid)+"."+accessFileName(clientID))
+}
+
+func accessFileName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+}
+
+func (s *fileAccessRequestStore) lock() (*os.File, error) {
+	lock, err := fsutil.LockFile(filepath.Join(s.dir, ".lock"))
+	if err != nil {
+		return nil, fmt.Errorf("lock access request dir error: %v", err)
+	}
+
+	return lock, nil
+}
+
+func (s *fileAccessRequestStore) Save(req *AccessRequest) error {
+	lock, err := s.lock()
+	if err != nil {
+		return err
+	}
+
+	defer lock.Close()
+
+	return s.write(req)
+}
+
+// write saves req where its status belongs, and removes it from the other
+// place. The dir lock must be held.
+func (s *fileAccessRequestStore) write(req *AccessRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("json.Marshal error: %v", err)
+	}
+
+	path, stale := s.pendingPath(req.SpNo), s.decidedPath(req.SpNo)
+	if req.Status != AccessPending {
+		path, stale = stale, path
+	}
+
+	if err := fsutil.WriteFileAtomic(path, data); err != nil {
+		return fmt.Errorf("write access request file error: %v", err)
+	}
+
+	if err := os.Remove(stale); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove stale access request file error: %v", err)
+	}
+
+	return nil
+}
+
+func (s *fileAccessRequestStore) Get(spNo string) (*AccessRequest, error) {
+	req, err := s.read(s.pendingPath(spNo))
+	if req != nil || err != nil {
+		return req, err
+	}
+
+	return s.read(s.decidedPath(spNo))
+}
+
+func (s *fileAccessRequestStore) Pending() ([]*AccessRequest, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("list access request files error: %v", err)
+	}
+
+	var reqs []*AccessRequest
+	for _, path := range paths {
+		req, err := s.read(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if req != nil && req.Status == AccessPending {
+			reqs = append(reqs, req)
+		}
+	}
+
+	sortAccessRequests(reqs)
+	return reqs, nil
+}
+
+func (s *fileAccessRequestStore) Claim(uid, clientID string) (bool, error) {
+	lock, err := s.lock()
+	if err != nil {
+		return false, err
+	}
+
+	defer lock.Close()
+
+	path := s.claimPath(uid, clientID)
+	if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) < accessClaimTTL {
+		return false, nil
+	}
+
+	reqs, err := s.Pending()
+	if err != nil {
+		return false, err
+	}
+
+	if hasAccessRequest(reqs, uid, clientID) {
+		return false, nil
+	}
+
+	if err := fsutil.WriteFileAtomic(path, nil); err != nil {
+		return false, fmt.Errorf("write access claim file error: %v", err)
+	}
+
+	return true, nil
+}
+
+func (s *fileAccessRequestStore) Release(uid, clientID string) error {
+	if err := os.Remove(s.claimPath(uid, clientID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove access claim file error: %v", err)
+	}
+
+	return nil
+}
+
+func (s *fileAccessRequestStore) Decide(spNo string, status AccessStatus) (*AccessRequest, error) {
+	lock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+
+	defer lock.Close()
+
+	req, err := s.read(s.pendingPath(spNo))
+	if err != nil || req == nil || req.Status != AccessPending {
+		return nil, err
+	}
+
+	req.Status = status
+	req.DecidedAt = time.Now()
+	if err := s.write(req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func (s *fileAccessRequestStore) read(path string) (*AccessRequest, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("read access request file error: %v", err)
+	}
+
+	var req AccessRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal error: %v", err)
+	}
+
+	return &req, nil
+}
+
+// hasAccessRequest reports whether reqs hold one of uid for clientID.
+func hasAccessRequest(reqs []*AccessRequest, uid, clientID string) bool {
+	for _, req := range reqs {
+		if req.UserID == uid && req.ClientID == clientID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortAccessRequests(reqs []*AccessRequest) {
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].CreatedAt.Before(reqs[j].CreatedAt) })
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestAccessRequestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "access")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name  string
+		store func() (AccessRequestStore, error)
+	}{
+		{"memory", func() (AccessRequestStore, error) { return NewMemoryAccessRequestStore(), nil }},
+		{"file", func() (AccessRequestStore, error) { return NewFileAccessRequestStore(dir) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := tt.store()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			now := time.Now().Round(time.Second)
+			reqs := []*AccessRequest{
+				{SpNo: "202610170002", UserID: "lisi", Status: AccessPending, CreatedAt: now.Add(time.Minute)},
+				{SpNo: "202610170001", UserID: "zhangsan", Status: AccessPending, CreatedAt: now},
+			}
+
+			for _, req := range reqs {
+				if err := s.Save(req); err != nil {
+					t.Fatalf("Save error: %v", err)
+				}
+			}
+
+			pending, err := s.Pending()
+			if err != nil {
+				t.Fatalf("Pending error: %v", err)
+			}
+
+			if len(pending) != 2 || pending[0].UserID != "zhangsan" || pending[1].UserID != "lisi" {
+				t.Fatalf("Pending = %+v, want zhangsan then lisi", pending)
+			}
+
+			decided := *pending[0]
+			decided.Status = AccessGranted
+			decided.DecidedAt = now
+			if err := s.Save(&decided); err != nil {
+				t.Fatalf("Save decided error: %v", err)
+			}
+
+			if pending, _ := s.Pending(); len(pending) != 1 || pending[0].UserID != "lisi" {
+				t.Errorf("Pending after decision = %+v, want lisi only", pending)
+			}
+
+			req, err := s.Get("202610170001")
+			if err != nil || req == nil || req.Status != AccessGranted {
+				t.Errorf("Get decided = %+v, %v, want the granted request", req, err)
+			}
+
+			if req, err := s.Get("202610170009"); req != nil || err != nil {
+				t.Errorf("Get unknown = %+v, %v, want nil", req, err)
+			}
+		})
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(paths) != 1 {
+		t.Errorf("pending files = %v, want the one of lisi", paths)
+	}
+}
+
+func TestAccessRequestStoreClaimAndDecide(t *testing.T) {
+	dir, err := ioutil.TempDir("", "access")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name  string
+		store func() (AccessRequestStore, error)
+	}{
+		{"memory", func() (AccessRequestStore, error) { return NewMemoryAccessRequestStore(), nil }},
+		{"file", func() (AccessRequestStore, error) { return NewFileAccessRequestStore(dir) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := tt.store()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ok, err := s.Claim("zhangsan", "wiki"); !ok || err != nil {
+				t.Fatalf("Claim = %v, %v, want true", ok, err)
+			}
+
+			if ok, err := s.Claim("zhangsan", "wiki"); ok || err != nil {
+				t.Errorf("Claim while claimed = %v, %v, want false", ok, err)
+			}
+
+			if ok, err := s.Claim("zhangsan", "mail"); !ok || err != nil {
+				t.Errorf("Claim of other client = %v, %v, want true", ok, err)
+			}
+
+			req := &AccessRequest{SpNo: "202610170001", UserID: "zhangsan", ClientID: "wiki", Status: AccessPending}
+			if err := s.Save(req); err != nil {
+				t.Fatalf("Save error: %v", err)
+			}
+
+			if err := s.Release("zhangsan", "wiki"); err != nil {
+				t.Fatalf("Release error: %v", err)
+			}
+
+			if ok, err := s.Claim("zhangsan", "wiki"); ok || err != nil {
+				t.Errorf("Claim while pending = %v, %v, want false", ok, err)
+			}
+
+			decided, err := s.Decide(req.SpNo, AccessGranted)
+			if err != nil || decided == nil || decided.Status != AccessGranted || decided.DecidedAt.IsZero() {
+				t.Fatalf("Decide = %+v, %v, want the granted request", decided, err)
+			}
+
+			if again, err := s.Decide(req.SpNo, AccessRejected); again != nil || err != nil {
+				t.Errorf("Decide of decided request = %+v, %v, want nil", again, err)
+			}
+
+			if ok, err := s.Claim("zhangsan", "wiki"); !ok || err != nil {
+				t.Errorf("Claim after decision = %v, %v, want true", ok, err)
+			}
+
+			decided.Status = AccessPending
+			if err := s.Save(decided); err != nil {
+				t.Fatalf("Save back to pending error: %v", err)
+			}
+
+			if got, err := s.Get(req.SpNo); err != nil || got == nil || got.Status != AccessPending {
+				t.Errorf("Get after putting back = %+v, %v, want pending", got, err)
+			}
+		})
+	}
+}
+
+func TestAccessRequestHandlerToken(t *testing.T) {
+	s := &Server{
+		cfg:    &Config{CookieSecret: "secret"},
+		store:  sessions.NewCookieStore(cookieKeys("secret")),
+		access: NewMemoryAccessRequestStore(),
+	}
+
+	signIn := httptest.NewRequest(http.MethodGet, "/", nil)
+	session := s.session(signIn)
+	session.Values["uid"] = "zhangsan"
+
+	rec := httptest.NewRecorder()
+	if err := session.Save(signIn, rec); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := rec.Result().Cookies()
+	id := &identity{UserID: "zhangsan"}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"missing", ""},
+		{"forged", "0123456789abcdef"},
+		{"other consent", s.accessToken(id, "consent-2")},
+		{"other user", s.accessToken(&identity{UserID: "lisi"}, "consent-1")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"consent": {"consent-1"}, "reason": {"work"}, "token": {tt.token}}
+			r := httptest.NewRequest(http.MethodPost, pathAccessRequests, strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			for _, c := range cookies {
+				r.AddCookie(c)
+			}
+
+			w := httptest.NewRecorder()
+			s.AccessRequestHandler(w, r)
+
+			if w.Code != http.StatusForbidden {
+				t.Errorf("status = %v, want %v", w.Code, http.StatusForbidden)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/sessions"
+	"github.com/pragkent/hydra-wework/wework"
+)
+
+// identity is the wework user signed in through the callback.
+type identity struct {
+	// CorpID is set for users signed in through a service provider.
+	CorpID string
+	UserID string
+
+	// OpenID identifies non-members, e.g. external contacts, when external
+	// logins are enabled. UserID is empty for them.
+	OpenID     string
+	ExternalID string
+
+	// UserTicket grants access to the sensitive profile. It is only set
+	// right after authentication.
+	UserTicket string
+
+	// Detail is the sensitive profile, if the user granted access to it.
+	Detail *wework.UserDetail
+
+	// Login is the profile returned by a service provider login.
+	Login *wework.LoginUserInfo
+}
+
+func (id *identity) subject() string {
+	if id.external() {
+		return externalSubjectOf(id.OpenID)
+	}
+
+	return subjectOf(id.CorpID, id.UserID)
+}
+
+// external reports whether the user is not a member of the corp.
+func (id *identity) external() bool {
+	return id.UserID == ""
+}
+
+// authenticator signs users in with either a self-built app or a service
+// provider.
+type authenticator interface {
+	AuthURL(r *http.Request, callbackURL, state string) string
+	Authenticate(ctx context.Context, r *http.Request) (*identity, error)
+}
+
+type corpAuthenticator struct {
+	wcli *wework.Client
+
+	// external allows non-members to sign in.
+	external bool
+}
+
+func (a *corpAuthenticator) AuthURL(r *http.Request, callbackURL, state string) string {
+	if isInWework(r) {
+		return a.wcli.GetOAuthURL(callbackURL, state)
+	}
+
+	return a.wcli.GetQRConnectURL(callbackURL, state)
+}
+
+func (a *corpAuthenticator) Authenticate(ctx context.Context, r *http.Request) (*identity, error) {
+	info, err := a.wcli.AuthenticateContext(ctx, r.URL.Query().Get("code"))
+	if err == wework.ErrNotMember && a.external && info.OpenID != "" {
+		return &identity{
+			OpenID:     info.OpenID,
+			ExternalID: info.ExternalID,
+		}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &identity{
+		UserID:     info.UserID,
+		UserTicket: info.UserTicket,
+	}, nil
+}
+
+type providerAuthenticator struct {
+	pcli *wework.ProviderClient
+}
+
+func (a *providerAuthenticator) AuthURL(r *http.Request, callbackURL, state string) string {
+	return a.pcli.GetQRConnectURL(callbackURL, state)
+}
+
+func (a *providerAuthenticator) Authenticate(ctx context.Context, r *http.Request) (*identity, error) {
+	info, err := a.pcli.GetLoginInfoContext(ctx, r.URL.Query().Get("auth_code"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &identity{
+		CorpID: info.CorpInfo.CorpID,
+		UserID: info.UserInfo.UserID,
+		Login:  &info.UserInfo,
+	}, nil
+}
+
+// saveIdentity keeps id in the session, replacing the previous user.
+func (s *Server) saveIdentity(ctx context.Context, session *sessions.Session, id *identity) {
+	session.Values["uid"] = id.UserID
+	session.Values["corpid"] = id.CorpID
+	session.Values["openid"] = id.OpenID
+	session.Values["external_userid"] = id.ExternalID
+	delete(session.Values, "detail")
+	delete(session.Values, "login")
+
+	if id.UserTicket != "" {
+		s.saveUserDetail(ctx, session, id.UserTicket)
+	}
+
+	if id.Login != nil {
+		setSessionJSON(session, "login", id.Login)
+	}
+}
+
+// loadIdentity returns the user signed in the session, or nil if there is
+// none.
+func loadIdentity(session *sessions.Session) *identity {
+	uid, _ := session.Values["uid"].(string)
+	openID, _ := session.Values["openid"].(string)
+	if uid == "" && openID == "" {
+		return nil
+	}
+
+	corpID, _ := session.Values["corpid"].(string)
+	externalID, _ := session.Values["external_userid"].(string)
+
+	id := &identity{
+		CorpID:     corpID,
+		UserID:     uid,
+		OpenID:     openID,
+		ExternalID: externalID,
+	}
+
+	if id.external() {
+		return id
+	}
+
+	id.Detail = loadUserDetail(session, uid)
+
+	var login wework.LoginUserInfo
+	if getSessionJSON(session, "login", &login) && login.UserID == uid {
+		id.Login = &login
+	}
+
+	return id
+}
+
+func setSessionJSON(session *sessions.Session, key string, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		glog.Warningf("Encode session %v failed. %v", key, err)
+		return
+	}
+
+	session.Values[key] = string(b)
+}
+
+func getSessionJSON(session *sessions.Session, key string, v interface{}) bool {
+	s, ok := session.Values[key].(string)
+	if !ok || s == "" {
+		return false
+	}
+
+	if err := json.Unmarshal([]byte(s), v); err != nil {
+		glog.Warningf("Decode session %v failed. %v", key, err)
+		return false
+	}
+
+	return true
+}
@@ -1,6 +1,15 @@
 package server
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pragkent/hydra-wework/wework"
+)
 
 type Config struct {
 	BindAddr          string
@@ -11,7 +20,130 @@ type Config struct {
 	WeworkCorpID      string
 	WeworkAgentID     string
 	WeworkSecret      string
+	WeworkAPIURL      string
+	WeworkTimeout     time.Duration
+	WeworkTokenRatio  float64
+	WeworkTokenDir    string
+	WeworkMaxRetries  int
+	WeworkRateLimit   int
+	WeworkOAuthScope  string
 	HTTPS             bool
+
+	// WeworkEndpointRateLimits maps wework apis, e.g. user/get, to the calls
+	// per minute allowed to them instead of WeworkRateLimit.
+	WeworkEndpointRateLimits map[string]int
+
+	// WeworkContactsSecret is the secret of the contacts sync app, used to
+	// read departments, tags and the directory instead of WeworkSecret.
+	WeworkContactsSecret string
+
+	// WeworkApprovalSecret is the secret of the approval app, used to submit
+	// access requests instead of WeworkSecret.
+	WeworkApprovalSecret string
+
+	// WeworkVisibleRangeTTL is how long the visible range of the app is
+	// cached. Users outside of it are denied consent.
+	WeworkVisibleRangeTTL time.Duration
+
+	// DirectorySyncInterval enables the directory replica, synced at this
+	// interval and saved to DirectorySnapshot if set. Sign-ins read profiles
+	// from it while it is at most DirectoryMaxStaleness old.
+	DirectorySyncInterval time.Duration
+	DirectorySnapshot     string
+	DirectoryMaxStaleness time.Duration
+
+	// WeworkCallbackToken and WeworkCallbackAESKey enable the events
+	// endpoint receiving contact changes.
+	WeworkCallbackToken  string
+	WeworkCallbackAESKey string
+
+	// WeworkProviderSecret switches to service provider mode, signing in
+	// users of any corp authorized for the suite. WeworkCorpID is then the
+	// provider corp id, and subjects are qualified with the user's corp id.
+	WeworkProviderSecret string
+	WeworkSuiteID        string
+	WeworkSuiteSecret    string
+
+	// WeworkSuiteCallbackToken and WeworkSuiteCallbackAESKey enable the
+	// endpoint receiving suite tickets.
+	WeworkSuiteCallbackToken  string
+	WeworkSuiteCallbackAESKey string
+
+	// WeworkPermanentCodes maps authorized corp ids to their permanent
+	// codes. Profiles of users of other corps are limited to the login info.
+	WeworkPermanentCodes map[string]string
+
+	// LoginPage serves desktop browsers a login page embedding the wwLogin
+	// panel instead of redirecting them to the wework login. LoginLang and
+	// LoginStylesheet customize the panel.
+	LoginPage       bool
+	LoginLang       string
+	LoginStylesheet string
+
+	// ExternalLogin lets non-members, e.g. external contacts, sign in under
+	// an external:<openid> subject with limited claims. They can only
+	// consent to ExternalLoginClients.
+	ExternalLogin        bool
+	ExternalLoginClients []string
+
+	// SecondaryVerify hosts the secondary verification page new members
+	// visit before joining. They must have an email in VerifyEmailDomains
+	// and be in or below one of VerifyDepartments, if set. VerifyApproval
+	// additionally queues them for approval by an admin, recording the
+	// requests in VerifyRequestDir.
+	SecondaryVerify    bool
+	VerifyEmailDomains []string
+	VerifyDepartments  []int
+	VerifyApproval     bool
+	VerifyRequestDir   string
+
+	// PeopleAPI serves the people search at /api/people to holders of
+	// access tokens granted PeopleScope. Without the directory replica,
+	// members are listed every PeopleTTL.
+	PeopleAPI   bool
+	PeopleScope string
+	PeopleTTL   time.Duration
+
+	// ClientGroups maps hydra clients to the warden group users must be in
+	// to consent to them.
+	ClientGroups map[string]string
+
+	// AccessRequests lets members lacking the group of a client request it
+	// from the denial page. Requests are submitted as approvals of template
+	// AccessTemplateID, whose AccessTemplateControl textarea holds the
+	// details, and routed to the department leaders. Decisions arrive as
+	// approval events and are also polled every AccessPollInterval. Requests
+	// are recorded in AccessRequestDir, which replicas must share.
+	AccessRequests        bool
+	AccessTemplateID      string
+	AccessTemplateControl string
+	AccessPollInterval    time.Duration
+	AccessRequestDir      string
+
+	// ReviewInterval enables periodic access reviews of ReviewGroups, or of
+	// the groups of ClientGroups if not set. Leaders are sent the members
+	// reporting to them, to keep or revoke through links to PublicHost
+	// signed with ReviewSecret. Reviews not done within ReviewDeadline are
+	// escalated to the leaders above. Reviews are recorded in ReviewFile,
+	// which replicas may share to take turns checking them.
+	ReviewInterval time.Duration
+	ReviewDeadline time.Duration
+	ReviewGroups   []string
+	ReviewSecret   string
+	ReviewFile     string
+	PublicHost     string
+
+	// AdminToken is the bearer token of the admin endpoints.
+	AdminToken string
+
+	// NotifyLoginClients lists the hydra clients for which users are
+	// messaged in wework on every sign-in.
+	NotifyLoginClients []string
+
+	// TrustedProxies lists the addresses or cidrs of the reverse proxies
+	// whose X-Forwarded-For and X-Real-IP headers are trusted to report the
+	// client address.
+	TrustedProxies []string
 }
 
 func (c *Config) Validate() error {
@@ -35,13 +167,200 @@ func (c *Config) Validate() error {
 		return errors.New("wework corp id is missing")
 	}
 
-	if c.WeworkAgentID == "" {
-		return errors.New("wework agent id is missing")
+	if c.ProviderMode() {
+		if err := c.validateProvider(); err != nil {
+			return err
+		}
+	} else {
+		if c.WeworkAgentID == "" {
+			return errors.New("wework agent id is missing")
+		}
+
+		if c.WeworkSecret == "" {
+			return errors.New("wework secret is missing")
+		}
+	}
+
+	if c.WeworkOAuthScope != wework.ScopeBase && c.WeworkOAuthScope != wework.ScopePrivateInfo {
+		return fmt.Errorf("wework oauth scope must be %s or %s", wework.ScopeBase, wework.ScopePrivateInfo)
+	}
+
+	if (c.WeworkCallbackToken == "") != (c.WeworkCallbackAESKey == "") {
+		return errors.New("wework callback token and aes key must be set together")
+	}
+
+	if c.LoginLang != "zh" && c.LoginLang != "en" {
+		return errors.New("login lang must be zh or en")
+	}
+
+	if c.LoginStylesheet != "" && !strings.HasPrefix(c.LoginStylesheet, "https://") {
+		return errors.New("login stylesheet must be an https url")
+	}
+
+	if c.ExternalLogin && c.ProviderMode() {
+		return errors.New("external login is not supported in provider mode")
+	}
+
+	if c.ExternalLogin && len(c.ExternalLoginClients) == 0 {
+		return errors.New("external login clients are missing")
+	}
+
+	if c.SecondaryVerify && c.ProviderMode() {
+		return errors.New("secondary verification is not supported in provider mode")
+	}
+
+	if c.VerifyApproval && c.AdminToken == "" {
+		return errors.New("admin token is required to approve joins")
+	}
+
+	if c.VerifyApproval && c.VerifyRequestDir == "" {
+		return errors.New("verify request dir is required to approve joins")
+	}
+
+	if c.AccessRequests {
+		if err := c.validateAccessRequests(); err != nil {
+			return err
+		}
+	}
+
+	if c.ReviewInterval > 0 {
+		if err := c.validateReviews(); err != nil {
+			return err
+		}
+	}
+
+	if c.PeopleAPI && c.ProviderMode() {
+		return errors.New("people api is not supported in provider mode")
+	}
+
+	if c.DirectorySyncInterval > 0 && c.ProviderMode() {
+		return errors.New("directory replica is not supported in provider mode")
+	}
+
+	if c.WeworkTokenDir != "" && runtime.GOOS == "windows" {
+		return errors.New("wework token dir is not supported on windows")
+	}
+
+	if _, err := parseNetworks(c.TrustedProxies); err != nil {
+		return fmt.Errorf("trusted proxies error: %v", err)
 	}
 
-	if c.WeworkSecret == "" {
-		return errors.New("wework secret is missing")
+	if c.WeworkMaxRetries < 0 {
+		return errors.New("wework max retries must not be negative")
+	}
+
+	if c.WeworkTokenRatio <= 0 || c.WeworkTokenRatio > 1 {
+		return errors.New("wework token refresh ratio must be in (0, 1]")
+	}
+
+	return nil
+}
+
+// ProviderMode reports whether users sign in through a service provider
+// rather than a self-built app.
+func (c *Config) ProviderMode() bool {
+	return c.WeworkProviderSecret != ""
+}
+
+func (c *Config) validateProvider() error {
+	if (c.WeworkSuiteCallbackToken == "") != (c.WeworkSuiteCallbackAESKey == "") {
+		return errors.New("wework suite callback token and aes key must be set together")
+	}
+
+	if len(c.WeworkPermanentCodes) == 0 {
+		return nil
+	}
+
+	if c.WeworkSuiteID == "" || c.WeworkSuiteSecret == "" {
+		return errors.New("wework suite id and secret are required with permanent codes")
+	}
+
+	if c.WeworkSuiteCallbackToken == "" {
+		return errors.New("wework suite callback token is required with permanent codes")
 	}
 
 	return nil
 }
+
+func (c *Config) validateAccessRequests() error {
+	if c.ProviderMode() {
+		return errors.New("access requests are not supported in provider mode")
+	}
+
+	if len(c.ClientGroups) == 0 {
+		return errors.New("client groups are required with access requests")
+	}
+
+	if c.AccessTemplateID == "" || c.AccessTemplateControl == "" {
+		return errors.New("access template id and control are required with access requests")
+	}
+
+	if c.AccessPollInterval <= 0 {
+		return errors.New("access poll interval must be positive")
+	}
+
+	if c.AccessRequestDir == "" {
+		return errors.New("access request dir is required with access requests")
+	}
+
+	if runtime.GOOS == "windows" {
+		return errors.New("access requests are not supported on windows")
+	}
+
+	return nil
+}
+
+func (c *Config) validateReviews() error {
+	if c.ProviderMode() {
+		return errors.New("access reviews are not supported in provider mode")
+	}
+
+	if len(c.ReviewGroups) == 0 && len(c.ClientGroups) == 0 {
+		return errors.New("review groups or client groups are required with access reviews")
+	}
+
+	if c.ReviewDeadline <= 0 {
+		return errors.New("review deadline must be positive")
+	}
+
+	if c.ReviewSecret == "" || c.ReviewFile == "" || c.PublicHost == "" {
+		return errors.New("review secret, review file and public host are required with access reviews")
+	}
+
+	if runtime.GOOS == "windows" {
+		return errors.New("access reviews are not supported on windows")
+	}
+
+	return nil
+}
+
+// parseNetworks parses addresses and cidrs into networks, an address being a
+// network of its own.
+func parseNetworks(values []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("illegal address: %v", v)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, err
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
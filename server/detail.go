@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/sessions"
+	"github.com/pragkent/hydra-wework/wework"
+)
+
+// saveUserDetail fetches the sensitive profile with the user ticket and keeps
+// it in the session, since the ticket expires long before the session does.
+// Only the fields claimed are kept, so the cookie stays small.
+func (s *Server) saveUserDetail(ctx context.Context, session *sessions.Session, userTicket string) {
+	if s.wcli == nil {
+		return
+	}
+
+	detail, err := s.wcli.GetUserDetailContext(ctx, userTicket)
+	if err != nil {
+		glog.Warningf("Get user detail failed. %v", err)
+		return
+	}
+
+	setSessionJSON(session, "detail", &wework.UserDetail{
+		UserID:  detail.UserID,
+		Gender:  detail.Gender,
+		Avatar:  detail.Avatar,
+		Mobile:  detail.Mobile,
+		Email:   detail.Email,
+		BizMail: detail.BizMail,
+	})
+}
+
+// loadUserDetail returns the sensitive profile of uid kept in the session, or
+// nil if there is none.
+func loadUserDetail(session *sessions.Session, uid string) *wework.UserDetail {
+	var detail wework.UserDetail
+	if !getSessionJSON(session, "detail", &detail) || detail.UserID != uid {
+		return nil
+	}
+
+	return &detail
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/pragkent/hydra-wework/wework"
+)
+
+var (
+	errUserInactive   = errors.New("User is not active")
+	errUserNotVisible = errors.New("User is outside the visible range of the app")
+
+	errExternalNotAllowed = errors.New("External users are not allowed to use the client")
+
+	errEmailDomain = errors.New("User email domain is not allowed")
+	errDepartment  = errors.New("User is not in an allowed department")
+
+	errGroupRequired = errors.New("User is not in the group required by the client")
+)
+
+// isAccessDenied reports whether err means the user must not be granted
+// access, as opposed to a failure to find out.
+func isAccessDenied(err error) bool {
+	return err == errUserInactive || err == errUserNotVisible || err == errExternalNotAllowed ||
+		err == errEmailDomain || err == errDepartment || err == errGroupRequired || err == wework.ErrNotMember || wework.IsNotFound(err)
+}
+
+// weworkErrorStatus maps a wework client error to the http status returned to
+// the browser.
+func weworkErrorStatus(err error) int {
+	switch {
+	case wework.IsInvalidCode(err):
+		return http.StatusBadRequest
+	case isAccessDenied(err):
+		return http.StatusForbidden
+	case wework.IsRetryable(err):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// denialReason returns the reason sent to hydra when rejecting consent.
+func denialReason(err error) string {
+	switch {
+	case err == errUserInactive:
+		return "user is not active"
+	case err == errUserNotVisible:
+		return "user is not allowed to use the app"
+	case err == errExternalNotAllowed:
+		return "external users are not allowed to use the client"
+	case err == errEmailDomain:
+		return "email domain is not allowed"
+	case err == errDepartment:
+		return "department is not allowed"
+	case err == errGroupRequired:
+		return "user is not in the group required by the client"
+	case err == wework.ErrNotMember:
+		return "user is not a member of the corp"
+	case wework.IsNotFound(err):
+		return "user does not exist"
+	default:
+		return "access denied"
+	}
+}
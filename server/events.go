@@ -0,0 +1,261 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pragkent/hydra-wework/wework"
+)
+
+const (
+	pathEvents      = "/wework/events"
+	pathSuiteEvents = "/wework/suite/events"
+
+	maxEventSize = 1 << 20
+
+	// maxEventSkew is how far the timestamp of a callback may be from now.
+	// Older callbacks are rejected, so captured ones cannot be replayed.
+	maxEventSkew = 5 * time.Minute
+
+	// eventQueueSize bounds the events received but not handled yet.
+	// Callbacks are answered 503 when it is full, for wework to redeliver.
+	eventQueueSize = 256
+
+	// eventTimeout bounds the hooks handling an event.
+	eventTimeout = time.Minute
+)
+
+var errEventTimestamp = errors.New("timestamp out of range")
+
+// EventHook is notified of callback events pushed by wework, e.g. to drop
+// cached profiles of changed users.
+type EventHook interface {
+	HandleEvent(ctx context.Context, ev *wework.Event)
+}
+
+// EventHookFunc adapts a func to EventHook.
+type EventHookFunc func(ctx context.Context, ev *wework.Event)
+
+func (f EventHookFunc) HandleEvent(ctx context.Context, ev *wework.Event) {
+	f(ctx, ev)
+}
+
+// AddEventHook registers h to be called for every event received.
+func (s *Server) AddEventHook(h EventHook) {
+	s.hooks = append(s.hooks, h)
+}
+
+// EventsHandler receives the wework callbacks: a GET for the url
+// verification handshake and POSTs carrying encrypted events.
+func (s *Server) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	signature := q.Get("msg_signature")
+	timestamp := q.Get("timestamp")
+	nonce := q.Get("nonce")
+
+	if r.Method == http.MethodGet {
+		echo, err := s.msgCrypt.VerifyURL(signature, timestamp, nonce, q.Get("echostr"))
+		if err != nil {
+			glog.Errorf("Verify callback url failed. %v", err)
+			http.Error(w, "Verify url failed", http.StatusBadRequest)
+			return
+		}
+
+		w.Write(echo)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := checkEventTimestamp(timestamp); err != nil {
+		glog.Errorf("Reject event sent at %q. %v", timestamp, err)
+		http.Error(w, "Invalid timestamp", http.StatusBadRequest)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxEventSize))
+	if err != nil {
+		glog.Errorf("Read event failed. %v", err)
+		http.Error(w, "Read event failed", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := s.msgCrypt.DecryptMessage(signature, timestamp, nonce, body)
+	if err != nil {
+		glog.Errorf("Decrypt event failed. %v", err)
+		http.Error(w, "Decrypt event failed", http.StatusBadRequest)
+		return
+	}
+
+	ev, err := wework.ParseEvent(msg)
+	if err != nil {
+		glog.Errorf("Parse event failed. %v", err)
+		http.Error(w, "Parse event failed", http.StatusBadRequest)
+		return
+	}
+
+	glog.V(2).Infof("Event received. %s %s %s", ev.Event, ev.ChangeType, ev.UserID)
+
+	select {
+	case s.events <- ev:
+	default:
+		glog.Errorf("Event queue full. Dropping %s %s %s for redelivery", ev.Event, ev.ChangeType, ev.UserID)
+		http.Error(w, "Busy", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// eventLoop passes the events received to the hooks, in order, outside the
+// callbacks, which wework times out after 5 seconds.
+func (s *Server) eventLoop() {
+	for {
+		select {
+		case <-s.closed:
+			return
+		case ev := <-s.events:
+			s.handleEvent(ev)
+		}
+	}
+}
+
+func (s *Server) handleEvent(ev *wework.Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+
+	for _, h := range s.hooks {
+		h.HandleEvent(ctx, ev)
+	}
+}
+
+// checkEventTimestamp rejects callbacks sent more than maxEventSkew from now.
+func checkEventTimestamp(timestamp string) error {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errEventTimestamp
+	}
+
+	skew := time.Since(time.Unix(sec, 0))
+	if skew > maxEventSkew || skew < -maxEventSkew {
+		return errEventTimestamp
+	}
+
+	return nil
+}
+
+// syncReplica resyncs the directory replica after contact changes.
+func (s *Server) syncReplica(ctx context.Context, ev *wework.Event) {
+	if ev.IsContactChange() {
+		s.replica.Trigger()
+	}
+}
+
+// logDirectoryChanges logs the members found added or removed by a sync of
+// the directory replica.
+func logDirectoryChanges(d *wework.Diff) {
+	for _, uid := range d.AddedUsers {
+		glog.Infof("Wework user %v added", uid)
+	}
+
+	for _, uid := range d.RemovedUsers {
+		glog.Infof("Wework user %v removed", uid)
+	}
+}
+
+// revokeDepartures removes members leaving the corp from all warden groups,
+// so they lose the clients granted through them even if a session or a
+// refresh token outlives them.
+func (s *Server) revokeDepartures(ctx context.Context, ev *wework.Event) {
+	if !ev.IsUserChange() || ev.ChangeType != wework.ChangeDeleteUser {
+		return
+	}
+
+	glog.Infof("Wework user %v deleted", ev.UserID)
+
+	subject := subjectOf("", ev.UserID)
+	groups, err := s.groupsOf(subject)
+	if err != nil {
+		glog.Errorf("Get warden groups of departed %v failed. %v", subject, err)
+		return
+	}
+
+	for _, group := range groups {
+		if err := s.removeGroupMember(group, subject); err != nil {
+			glog.Errorf("Remove departed %v from group %v failed. %v", subject, group, err)
+			continue
+		}
+
+		glog.Infof("Removed departed %v from group %v", subject, group)
+	}
+}
+
+// SuiteEventsHandler receives the instruction callbacks of the provider
+// suite. Only suite tickets are handled, which are required to obtain the
+// suite access token.
+func (s *Server) SuiteEventsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	signature := q.Get("msg_signature")
+	timestamp := q.Get("timestamp")
+	nonce := q.Get("nonce")
+
+	if r.Method == http.MethodGet {
+		echo, err := s.suiteCrypt.VerifyURL(signature, timestamp, nonce, q.Get("echostr"))
+		if err != nil {
+			glog.Errorf("Verify suite callback url failed. %v", err)
+			http.Error(w, "Verify url failed", http.StatusBadRequest)
+			return
+		}
+
+		w.Write(echo)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := checkEventTimestamp(timestamp); err != nil {
+		glog.Errorf("Reject suite event sent at %q. %v", timestamp, err)
+		http.Error(w, "Invalid timestamp", http.StatusBadRequest)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxEventSize))
+	if err != nil {
+		glog.Errorf("Read suite event failed. %v", err)
+		http.Error(w, "Read event failed", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := s.suiteCrypt.DecryptMessage(signature, timestamp, nonce, body)
+	if err != nil {
+		glog.Errorf("Decrypt suite event failed. %v", err)
+		http.Error(w, "Decrypt event failed", http.StatusBadRequest)
+		return
+	}
+
+	ev, err := wework.ParseEvent(msg)
+	if err != nil {
+		glog.Errorf("Parse suite event failed. %v", err)
+		http.Error(w, "Parse event failed", http.StatusBadRequest)
+		return
+	}
+
+	glog.V(2).Infof("Suite event received. %s %s", ev.InfoType, ev.AuthCorpID)
+
+	if ev.InfoType == wework.InfoSuiteTicket && s.pcli != nil {
+		s.pcli.SetSuiteTicket(ev.SuiteTicket)
+	}
+
+	w.Write([]byte("success"))
+}
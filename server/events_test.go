@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pragkent/hydra-wework/wework"
+	"github.com/pragkent/hydra-wework/wework/crypto"
+)
+
+func TestEventsHandler(t *testing.T) {
+	mc, err := crypto.New("QDG6eK", "jWmYm7qr5nMoAUwZRjGtBxmz3KA1tkAj3ykkR6q2B2C", "wx5823bf96d3bd56c7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(s *Server, sentAt time.Time) int {
+		encrypted, err := mc.Encrypt([]byte(`<xml><MsgType>event</MsgType><Event>change_contact</Event><ChangeType>delete_user</ChangeType><UserID>zhangsan</UserID></xml>`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		timestamp := strconv.FormatInt(sentAt.Unix(), 10)
+		q := url.Values{
+			"msg_signature": {mc.Signature(timestamp, "nonce", encrypted)},
+			"timestamp":     {timestamp},
+			"nonce":         {"nonce"},
+		}
+
+		body := fmt.Sprintf("<xml><ToUserName>wx5823bf96d3bd56c7</ToUserName><Encrypt>%s</Encrypt></xml>", encrypted)
+		r := httptest.NewRequest(http.MethodPost, pathEvents+"?"+q.Encode(), strings.NewReader(body))
+
+		w := httptest.NewRecorder()
+		s.EventsHandler(w, r)
+		return w.Code
+	}
+
+	tests := []struct {
+		name   string
+		sentAt time.Time
+		want   int
+		queued bool
+	}{
+		{"now", time.Now(), http.StatusOK, true},
+		{"replayed", time.Now().Add(-time.Hour), http.StatusBadRequest, false},
+		{"future", time.Now().Add(time.Hour), http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := make(chan struct{})
+			handled := make(chan *wework.Event, 1)
+
+			s := &Server{
+				msgCrypt: mc,
+				events:   make(chan *wework.Event, 1),
+				closed:   make(chan struct{}),
+			}
+
+			s.AddEventHook(EventHookFunc(func(ctx context.Context, ev *wework.Event) {
+				<-release
+				handled <- ev
+			}))
+
+			go s.eventLoop()
+			defer close(s.closed)
+
+			if code := post(s, tt.sentAt); code != tt.want {
+				t.Fatalf("status = %v, want %v", code, tt.want)
+			}
+
+			close(release)
+
+			select {
+			case ev := <-handled:
+				if !tt.queued || ev.UserID != "zhangsan" {
+					t.Errorf("handled %+v, want queued %v", ev, tt.queued)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.queued {
+					t.Error("event not handled")
+				}
+			}
+		})
+	}
+}
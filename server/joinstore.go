@@ -0,0 +1,207 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pragkent/hydra-wework/internal/fsutil"
+)
+
+// JoinRequest is a new member waiting for an admin to approve its joining.
+type JoinRequest struct {
+	UserID      string    `json:"userid"`
+	Name        string    `json:"name"`
+	Email       string    `json:"email,omitempty"`
+	Mobile      string    `json:"mobile,omitempty"`
+	Departments []int     `json:"departments,omitempty"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// JoinRequestStore records the join requests pending approval.
+type JoinRequestStore interface {
+	// Add queues req, keeping the original request if its member is
+	// already pending.
+	Add(req *JoinRequest) error
+
+	// Remove dequeues the request of uid, returning nil if it is not
+	// pending.
+	Remove(uid string) (*JoinRequest, error)
+
+	// List returns the pending requests, oldest first.
+	List() ([]*JoinRequest, error)
+}
+
+type memoryJoinRequestStore struct {
+	mu      *sync.Mutex
+	pending map[string]JoinRequest
+}
+
+// NewMemoryJoinRequestStore returns a JoinRequestStore keeping requests in
+// memory. Pending requests are lost on restart.
+func NewMemoryJoinRequestStore() JoinRequestStore {
+	return &memoryJoinRequestStore{
+		mu:      &sync.Mutex{},
+		pending: make(map[string]JoinRequest),
+	}
+}
+
+func (s *memoryJoinRequestStore) Add(req *JoinRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.pending[req.UserID]; !ok {
+		s.pending[req.UserID] = *req
+	}
+
+	return nil
+}
+
+func (s *memoryJoinRequestStore) Remove(uid string) (*JoinRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, ok := s.pending[uid]
+	if !ok {
+		return nil, nil
+	}
+
+	delete(s.pending, uid)
+	return &req, nil
+}
+
+func (s *memoryJoinRequestStore) List() ([]*JoinRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reqs := make([]*JoinRequest, 0, len(s.pending))
+	for _, req := range s.pending {
+		req := req
+		reqs = append(reqs, &req)
+	}
+
+	sortJoinRequests(reqs)
+	return reqs, nil
+}
+
+type fileJoinRequestStore struct {
+	dir string
+	mu  *sync.Mutex
+}
+
+// NewFileJoinRequestStore returns a JoinRequestStore keeping one file per
+// pending request in dir, which replicas may share.
+func NewFileJoinRequestStore(dir string) (JoinRequestStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create join request dir error: %v", err)
+	}
+
+	return &fileJoinRequestStore{dir: dir, mu: &sync.Mutex{}}, nil
+}
+
+func (s *fileJoinRequestStore) path(uid string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.', r == '@':
+			return r
+		default:
+			return '_'
+		}
+	}, uid)
+
+	return filepath.Join(s.dir, name+".json")
+}
+
+func (s *fileJoinRequestStore) Add(req *JoinRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.path(req.UserID)
+	if existing, err := s.read(path); err != nil || existing != nil {
+		return err
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("json.Marshal error: %v", err)
+	}
+
+	if err := fsutil.WriteFileAtomic(path, data); err != nil {
+		return fmt.Errorf("write join request file error: %v", err)
+	}
+
+	return nil
+}
+
+// Remove deletes the file of uid. Of replicas removing it concurrently, only
+// the one whose removal succeeds gets the request.
+func (s *fileJoinRequestStore) Remove(uid string) (*JoinRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.path(uid)
+	req, err := s.read(path)
+	if err != nil || req == nil {
+		return nil, err
+	}
+
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("remove join request file error: %v", err)
+	}
+
+	return req, nil
+}
+
+func (s *fileJoinRequestStore) List() ([]*JoinRequest, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("list join request files error: %v", err)
+	}
+
+	reqs := make([]*JoinRequest, 0, len(paths))
+	for _, path := range paths {
+		req, err := s.read(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if req != nil {
+			reqs = append(reqs, req)
+		}
+	}
+
+	sortJoinRequests(reqs)
+	return reqs, nil
+}
+
+func (s *fileJoinRequestStore) read(path string) (*JoinRequest, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("read join request file error: %v", err)
+	}
+
+	var req JoinRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal error: %v", err)
+	}
+
+	return &req, nil
+}
+
+func sortJoinRequests(reqs []*JoinRequest) {
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].RequestedAt.Before(reqs[j].RequestedAt) })
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestJoinRequestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "joins")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name  string
+		store func() (JoinRequestStore, error)
+	}{
+		{"memory", func() (JoinRequestStore, error) { return NewMemoryJoinRequestStore(), nil }},
+		{"file", func() (JoinRequestStore, error) { return NewFileJoinRequestStore(dir) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := tt.store()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			now := time.Now().Round(time.Second)
+			reqs := []*JoinRequest{
+				{UserID: "lisi", Name: "李四", RequestedAt: now.Add(time.Minute)},
+				{UserID: "zhangsan", Name: "张三", RequestedAt: now},
+				{UserID: "lisi", Name: "李四", RequestedAt: now.Add(time.Hour)},
+			}
+
+			for _, req := range reqs {
+				if err := s.Add(req); err != nil {
+					t.Fatalf("Add error: %v", err)
+				}
+			}
+
+			pending, err := s.List()
+			if err != nil {
+				t.Fatalf("List error: %v", err)
+			}
+
+			if len(pending) != 2 || pending[0].UserID != "zhangsan" || pending[1].UserID != "lisi" {
+				t.Fatalf("List = %+v, want zhangsan then lisi", pending)
+			}
+
+			if !pending[1].RequestedAt.Equal(now.Add(time.Minute)) {
+				t.Errorf("RequestedAt of requeued lisi = %v, want the original %v", pending[1].RequestedAt, now.Add(time.Minute))
+			}
+
+			req, err := s.Remove("zhangsan")
+			if err != nil || req == nil || req.Name != "张三" {
+				t.Fatalf("Remove = %+v, %v, want the request of zhangsan", req, err)
+			}
+
+			if req, err := s.Remove("zhangsan"); req != nil || err != nil {
+				t.Errorf("Remove of removed request = %+v, %v, want nil", req, err)
+			}
+
+			if pending, _ := s.List(); len(pending) != 1 {
+				t.Errorf("List after Remove = %+v, want lisi only", pending)
+			}
+		})
+	}
+}
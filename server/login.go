@@ -0,0 +1,102 @@
+package server
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+
+	"github.com/golang/glog"
+	"github.com/pragkent/hydra-wework/wework"
+)
+
+const (
+	wwLoginSDKURL = "https://wwcdn.weixin.qq.com/node/open/js/wecom-jssdk-2.0.2.js"
+)
+
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Sign in{{if .ClientName}} to {{.ClientName}}{{end}}</title>
+<style>
+body { font-family: sans-serif; text-align: center; margin-top: 48px; color: #333; }
+#ww_login { display: inline-block; min-height: 400px; }
+.fallback { font-size: 13px; margin-top: 16px; }
+</style>
+</head>
+<body>
+<h2>Sign in{{if .ClientName}} to {{.ClientName}}{{end}}</h2>
+<p>Scan with WeCom to continue.</p>
+<div id="ww_login"></div>
+<p class="fallback">QR code not showing? <a href="{{.FallbackURL}}">Sign in on the WeCom page</a>.</p>
+<script src="{{.SDKURL}}"></script>
+<script>
+ww.createWWLoginPanel({
+  el: "#ww_login",
+  params: {{.Params}},
+  onLoginFail: function(err) {
+    console.error(err);
+  }
+});
+</script>
+</body>
+</html>
+`))
+
+type loginPage struct {
+	ClientName  string
+	Params      *wework.WebLogin
+	SDKURL      string
+	FallbackURL string
+}
+
+// useLoginPage reports whether r should get the embedded login page rather
+// than the redirect to the wework login.
+func (s *Server) useLoginPage(r *http.Request) bool {
+	return s.cfg.LoginPage && s.wcli != nil && !isInWework(r) && r.URL.Query().Get("fallback") == ""
+}
+
+func (s *Server) renderLogin(w http.ResponseWriter, r *http.Request, callbackURL, state string) {
+	params := s.wcli.GetWebLogin(callbackURL, state)
+	params.Lang = s.cfg.LoginLang
+	params.Href = s.cfg.LoginStylesheet
+
+	q := url.Values{}
+	q.Set("consent", state)
+	q.Set("fallback", "1")
+
+	page := loginPage{
+		ClientName:  s.clientName(state),
+		Params:      params,
+		SDKURL:      wwLoginSDKURL,
+		FallbackURL: pathAuth + "?" + q.Encode(),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := loginTemplate.Execute(w, &page); err != nil {
+		glog.Errorf("Render login page failed. %v", err)
+	}
+}
+
+// clientName returns the name of the hydra client requesting consent, or an
+// empty string if it cannot be found.
+func (s *Server) clientName(consentID string) string {
+	if consentID == "" {
+		return ""
+	}
+
+	request, response, err := s.hcli.GetOAuth2ConsentRequest(consentID)
+	if err != nil || response.StatusCode != http.StatusOK {
+		glog.Warningf("Get consent request %v failed. %v", consentID, err)
+		return ""
+	}
+
+	client, response, err := s.hcli.GetOAuth2Client(request.ClientId)
+	if err != nil || response.StatusCode != http.StatusOK {
+		glog.Warningf("Get client %v failed. %v", request.ClientId, err)
+		return request.ClientId
+	}
+
+	return firstOf(client.ClientName, client.Id)
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pragkent/hydra-wework/wework"
+)
+
+const (
+	notifyTimeout = 10 * time.Second
+)
+
+// notifyLogin messages uid through the app when it signs in to one of the
+// clients configured as sensitive. It does not block the login.
+func (s *Server) notifyLogin(r *http.Request, uid, clientID string) {
+	if !contains(s.cfg.NotifyLoginClients, clientID) {
+		return
+	}
+
+	content := loginNotice(clientID, s.clientIP(r), r.UserAgent(), time.Now())
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+
+		resp, err := s.wcli.SendMessageContext(ctx, wework.NewTextMessage(content, uid))
+		if err != nil {
+			glog.Errorf("Send login notification to %v failed. %v", uid, err)
+			return
+		}
+
+		if resp.InvalidUser != "" {
+			glog.Warningf("Send login notification to %v failed. Invalid user: %v", uid, resp.InvalidUser)
+		}
+	}()
+}
+
+func loginNotice(clientID, ip, userAgent string, t time.Time) string {
+	return fmt.Sprintf(
+		"New sign-in to %s\nTime: %s\nIP: %s\nUser agent: %s\n\nIf this was not you, contact your administrator.",
+		clientID,
+		t.Format("2006-01-02 15:04:05 MST"),
+		ip,
+		userAgent)
+}
+
+// clientIP returns the address of the browser. The address reported by a
+// reverse proxy is only used if the request comes from a trusted proxy, in
+// which case X-Forwarded-For is walked from the right, skipping the trusted
+// proxies, since only the hops they appended can be relied on.
+func (s *Server) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !s.trustedProxy(host) {
+		return host
+	}
+
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if i == 0 || !s.trustedProxy(hop) {
+				return hop
+			}
+		}
+	}
+
+	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+
+	return host
+}
+
+func (s *Server) trustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range s.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
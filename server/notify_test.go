@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := parseNetworks([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{trustedProxies: trusted}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		realIP     string
+		want       string
+	}{
+		{"direct", "203.0.113.7:1234", "", "", "203.0.113.7"},
+		{"spoofed forwarded for", "203.0.113.7:1234", "198.51.100.1", "", "203.0.113.7"},
+		{"spoofed real ip", "203.0.113.7:1234", "", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"trusted proxy address", "192.168.1.1:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"chained proxies", "10.1.2.3:1234", "198.51.100.1, 10.4.5.6", "", "198.51.100.1"},
+		{"spoofed hop before proxy", "10.1.2.3:1234", "1.1.1.1, 198.51.100.1", "", "198.51.100.1"},
+		{"all hops trusted", "10.1.2.3:1234", "10.7.7.7, 10.4.5.6", "", "10.7.7.7"},
+		{"trusted real ip", "10.1.2.3:1234", "", "198.51.100.1", "198.51.100.1"},
+		{"trusted without headers", "10.1.2.3:1234", "", "", "10.1.2.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			if got := s.clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{"10.0.0.0/8", false},
+		{"192.168.1.1", false},
+		{"::1", false},
+		{"fd00::/8", false},
+		{"proxy.local", true},
+		{"10.0.0.0/33", true},
+	}
+
+	for _, tt := range tests {
+		if _, err := parseNetworks([]string{tt.value}); (err != nil) != tt.wantErr {
+			t.Errorf("parseNetworks(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/ory/hydra/sdk/go/hydra/swagger"
+	"github.com/pragkent/hydra-wework/wework"
+)
+
+const (
+	pathPeople = "/api/people"
+
+	defaultPeopleLimit = 20
+	maxPeopleLimit     = 100
+)
+
+// Person is a member found by the people search.
+type Person struct {
+	UserID      string   `json:"userid"`
+	Name        string   `json:"name"`
+	EnglishName string   `json:"english_name,omitempty"`
+	Alias       string   `json:"alias,omitempty"`
+	Email       string   `json:"email,omitempty"`
+	Position    string   `json:"position,omitempty"`
+	Avatar      string   `json:"avatar,omitempty"`
+	ThumbAvatar string   `json:"thumb_avatar,omitempty"`
+	Departments []string `json:"departments,omitempty"`
+}
+
+type peopleResponse struct {
+	People []Person `json:"people"`
+}
+
+// PeopleHandler searches members by userid, name, pinyin of the name,
+// english name, alias and email. Callers authenticate with a hydra access
+// token granted the people scope.
+func (s *Server) PeopleHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := s.introspect(r, s.cfg.PeopleScope)
+	if err != nil {
+		glog.Errorf("Introspect access token failed. %v", err)
+		http.Error(w, "Introspect access token error", http.StatusBadGateway)
+		return
+	}
+
+	if token == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q := normalizeQuery(r.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(w, "Query is missing", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultPeopleLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+
+		if limit > maxPeopleLimit {
+			limit = maxPeopleLimit
+		}
+	}
+
+	index, err := s.people.load(r.Context())
+	if err != nil {
+		glog.Errorf("Load people failed. %v", err)
+		http.Error(w, "Load people error", weworkErrorStatus(err))
+		return
+	}
+
+	glog.Infof("People search %q by %v", q, token.Sub)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(&peopleResponse{People: index.search(q, limit)})
+}
+
+// introspect returns the access token r carries if it is active and granted
+// scope, or nil.
+func (s *Server) introspect(r *http.Request, scope string) (*swagger.OAuth2TokenIntrospection, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, nil
+	}
+
+	result, response, err := s.hcli.IntrospectOAuth2Token(token, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspect unexpected http status: %v", response.Status)
+	}
+
+	if !result.Active {
+		return nil, nil
+	}
+
+	return result, nil
+}
+
+// bearerToken returns the bearer token of r, or an empty string.
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return ""
+	}
+
+	return strings.TrimPrefix(h, "Bearer ")
+}
+
+// peopleDirectory loads the members to search. It reads them from the
+// directory replica while it is fresh, and otherwise lists them itself at
+// most every ttl.
+type peopleDirectory struct {
+	client       *wework.Client
+	replica      *wework.Replica
+	maxStaleness time.Duration
+	ttl          time.Duration
+
+	mu    *sync.Mutex
+	index *peopleIndex
+}
+
+func newPeopleDirectory(c *wework.Client, replica *wework.Replica, maxStaleness, ttl time.Duration) *peopleDirectory {
+	return &peopleDirectory{
+		client:       c,
+		replica:      replica,
+		maxStaleness: maxStaleness,
+		ttl:          ttl,
+		mu:           &sync.Mutex{},
+	}
+}
+
+// load returns the index of the members, rebuilding it if needed. The index
+// is built without holding the lock and swapped in once complete, so
+// searches are not held up by a slow listing.
+func (d *peopleDirectory) load(ctx context.Context) (*peopleIndex, error) {
+	d.mu.Lock()
+	index := d.index
+	d.mu.Unlock()
+
+	if d.replica != nil {
+		if snapshot := d.replica.Fresh(d.maxStaleness); snapshot != nil {
+			if index != nil && index.snapshot == snapshot {
+				return index, nil
+			}
+
+			index = newPeopleIndex(snapshot.Users, snapshot.DepartmentTree())
+			index.snapshot = snapshot
+			d.swap(index)
+			return index, nil
+		}
+	}
+
+	if index != nil && index.snapshot == nil && time.Since(index.loadedAt) < d.ttl {
+		return index, nil
+	}
+
+	tree, err := d.client.GetDepartmentTreeContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []wework.User
+	seen := make(map[string]bool)
+	for _, root := range tree.Roots {
+		list, err := d.client.ListUsersByDepartmentContext(ctx, root.ID, true, true).All()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, u := range list {
+			if !seen[u.UserID] {
+				seen[u.UserID] = true
+				users = append(users, u)
+			}
+		}
+	}
+
+	index = newPeopleIndex(users, tree)
+	d.swap(index)
+	return index, nil
+}
+
+func (d *peopleDirectory) swap(index *peopleIndex) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.index = index
+}
+
+// peopleIndex holds the search keys of members: lower case userid, names,
+// alias, emails and the pinyin readings of the name and alias with their
+// initials.
+type peopleIndex struct {
+	snapshot *wework.Snapshot
+	loadedAt time.Time
+	tree     *wework.DepartmentTree
+	people   []indexedPerson
+}
+
+type indexedPerson struct {
+	user *wework.User
+	keys []string
+}
+
+func newPeopleIndex(users []wework.User, tree *wework.DepartmentTree) *peopleIndex {
+	idx := &peopleIndex{
+		loadedAt: time.Now(),
+		tree:     tree,
+		people:   make([]indexedPerson, 0, len(users)),
+	}
+
+	for i := range users {
+		u := &users[i]
+		if u.Status != wework.UserActive {
+			continue
+		}
+
+		keys := []string{u.UserID, u.Name, u.EnglishName, u.Alias, u.Email, u.BizMail}
+		for _, name := range []string{u.Name, u.Alias} {
+			full, initials := namePinyin(name)
+			keys = append(keys, full...)
+			keys = append(keys, initials...)
+		}
+
+		p := indexedPerson{user: u}
+		for _, k := range keys {
+			if k = normalizeQuery(k); k != "" {
+				p.keys = append(p.keys, k)
+			}
+		}
+
+		idx.people = append(idx.people, p)
+	}
+
+	return idx
+}
+
+// search returns up to limit members matching q, best matches first.
+func (idx *peopleIndex) search(q string, limit int) []Person {
+	type match struct {
+		user  *wework.User
+		score int
+	}
+
+	var matches []match
+	for _, p := range idx.people {
+		best := 0
+		for _, k := range p.keys {
+			if score := matchScore(k, q); score > best {
+				best = score
+			}
+		}
+
+		if best > 0 {
+			matches = append(matches, match{p.user, best})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+
+		return matches[i].user.UserID < matches[j].user.UserID
+	})
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	people := make([]Person, 0, len(matches))
+	for _, m := range matches {
+		people = append(people, idx.person(m.user))
+	}
+
+	return people
+}
+
+func (idx *peopleIndex) person(u *wework.User) Person {
+	p := Person{
+		UserID:      u.UserID,
+		Name:        u.Name,
+		EnglishName: u.EnglishName,
+		Alias:       u.Alias,
+		Email:       u.BizMail,
+		Position:    u.Position,
+		Avatar:      u.Avatar,
+		ThumbAvatar: u.ThumbAvatar,
+	}
+
+	if p.Email == "" {
+		p.Email = u.Email
+	}
+
+	for _, id := range u.Department {
+		if path := idx.tree.Path(id); path != "" {
+			p.Departments = append(p.Departments, path)
+		}
+	}
+
+	return p
+}
+
+// matchScore rates how well key matches q: exactly, by prefix, by substring
+// or as a subsequence, e.g. "zhsan" in "zhangsan". It returns 0 if q does
+// not match.
+func matchScore(key, q string) int {
+	switch {
+	case key == q:
+		return 4
+	case strings.HasPrefix(key, q):
+		return 3
+	case strings.Contains(key, q):
+		return 2
+	case isSubsequence(q, key):
+		return 1
+	default:
+		return 0
+	}
+}
+
+func isSubsequence(q, s string) bool {
+	rs := []rune(s)
+	i := 0
+	for _, c := range q {
+		for i < len(rs) && rs[i] != c {
+			i++
+		}
+
+		if i == len(rs) {
+			return false
+		}
+
+		i++
+	}
+
+	return true
+}
+
+func normalizeQuery(q string) string {
+	return strings.Replace(strings.ToLower(strings.TrimSpace(q)), " ", "", -1)
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pragkent/hydra-wework/wework"
+)
+
+func TestNamePinyin(t *testing.T) {
+	tests := []struct {
+		name         string
+		wantFull     []string
+		wantInitials []string
+	}{
+		{"张三", []string{"zhangsan"}, []string{"zs"}},
+		{"张-三", []string{"zhangsan"}, []string{"zs"}},
+		{"单柏", []string{"danbai", "danbo", "shanbai", "shanbo"}, []string{"db", "db", "sb", "sb"}},
+		{"曾单柏乐", []string{"cengdanbaile", "cengdanbaiyue", "cengdanbole", "cengdanboyue"}, []string{"cdbl", "cdby", "cdbl", "cdby"}},
+		{"Tom李", []string{"tomli"}, []string{"toml"}},
+		{"Tom", nil, nil},
+		{"张龘三", nil, nil},
+		{"", nil, nil},
+	}
+
+	for _, tt := range tests {
+		full, initials := namePinyin(tt.name)
+		if !reflect.DeepEqual(full, tt.wantFull) || !reflect.DeepEqual(initials, tt.wantInitials) {
+			t.Errorf("namePinyin(%q) = %v, %v, want %v, %v", tt.name, full, initials, tt.wantFull, tt.wantInitials)
+		}
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	tests := []struct {
+		key  string
+		q    string
+		want int
+	}{
+		{"zhangsan", "zhangsan", 4},
+		{"zhangsan", "zhang", 3},
+		{"zhangsan", "san", 2},
+		{"zhangsan", "zs", 1},
+		{"张三", "张三", 4},
+		{"张三", "三", 2},
+		{"zhangsan", "lisi", 0},
+		{"zs", "zhangsan", 0},
+		{"zhangsan", "sz", 0},
+	}
+
+	for _, tt := range tests {
+		if got := matchScore(tt.key, tt.q); got != tt.want {
+			t.Errorf("matchScore(%q, %q) = %d, want %d", tt.key, tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestPeopleIndexSearch(t *testing.T) {
+	users := []wework.User{
+		{UserID: "zhangsan", Name: "张三", Status: wework.UserActive},
+		{UserID: "zhangsanfeng", Name: "张三丰", Status: wework.UserActive},
+		{UserID: "lisi", Name: "李四", Alias: "Lisa", Status: wework.UserActive},
+		{UserID: "left", Name: "张三", Status: wework.UserDisabled},
+		{UserID: "u1001", Name: "王龘", Status: wework.UserActive},
+	}
+
+	idx := newPeopleIndex(users, wework.NewDepartmentTree(nil))
+
+	tests := []struct {
+		q     string
+		limit int
+		want  []string
+	}{
+		{"zhangsan", 10, []string{"zhangsan", "zhangsanfeng"}},
+		{"zs", 10, []string{"zhangsan", "zhangsanfeng"}},
+		{"zsf", 10, []string{"zhangsanfeng"}},
+		{"lisa", 10, []string{"lisi"}},
+		{"张三", 1, []string{"zhangsan"}},
+		{"wangwu", 10, nil},
+		{"王龘", 10, []string{"u1001"}},
+		{"wang", 10, nil},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, p := range idx.search(normalizeQuery(tt.q), tt.limit) {
+			got = append(got, p.UserID)
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("search(%q) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package server
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// pinyinSyllables lists the characters common in names by their pinyin,
+// without tones. Characters with several readings are listed under each.
+var pinyinSyllables = map[string]string{
+	"a":      "阿啊",
+	"ai":     "艾爱蔼",
+	"an":     "安岸",
+	"ang":    "昂",
+	"ao":     "敖奥傲澳",
+	"ba":     "巴八芭",
+	"bai":    "白百柏佰",
+	"ban":    "班斑",
+	"bang":   "邦帮榜",
+	"bao":    "包宝保鲍豹",
+	"bei":    "北贝蓓",
+	"ben":    "本贲",
+	"bi":     "毕比碧璧弼",
+	"bian":   "边卞",
+	"biao":   "彪标",
+	"bin":    "宾彬斌滨",
+	"bing":   "冰兵炳秉丙",
+	"bo":     "博波柏伯勃泊渤",
+	"bu":     "步布卜",
+	"cai":    "蔡才彩",
+	"can":    "灿参",
+	"cang":   "仓苍沧",
+	"cao":    "曹",
+	"ce":     "策",
+	"cen":    "岑",
+	"ceng":   "曾",
+	"cha":    "查",
+	"chai":   "柴",
+	"chan":   "婵蝉禅",
+	"chang":  "常昌长畅",
+	"chao":   "超朝潮巢",
+	"che":    "车彻",
+	"chen":   "陈晨辰沉琛臣忱",
+	"cheng":  "程成城承诚澄橙丞呈",
+	"chi":    "池驰迟赤",
+	"chong":  "崇冲",
+	"chou":   "仇",
+	"chu":    "楚初储褚",
+	"chuan":  "川传",
+	"chun":   "春纯淳椿",
+	"ci":     "慈词",
+	"cong":   "丛聪从琮",
+	"cui":    "崔翠萃",
+	"cun":    "村存",
+	"da":     "达大",
+	"dai":    "戴代黛岱",
+	"dan":    "丹单旦",
+	"dang":   "党",
+	"dao":    "道",
+	"de":     "德",
+	"deng":   "邓登",
+	"di":     "狄迪邸帝笛",
+	"dian":   "典殿",
+	"diao":   "刁",
+	"ding":   "丁鼎定",
+	"dong":   "东董冬栋",
+	"dou":    "窦",
+	"du":     "杜都笃",
+	"duan":   "段端",
+	"dun":    "敦顿",
+	"duo":    "多朵铎",
+	"e":      "鄂娥峨",
+	"en":     "恩",
+	"er":     "尔",
+	"fa":     "法",
+	"fan":    "范樊凡帆繁",
+	"fang":   "方房芳舫",
+	"fei":    "费飞菲斐",
+	"fen":    "芬汾",
+	"feng":   "冯丰凤峰锋枫风",
+	"fu":     "傅付符福富甫扶芙馥",
+	"gai":    "盖",
+	"gan":    "甘干淦",
+	"gang":   "刚钢港",
+	"gao":    "高郜",
+	"ge":     "葛戈格歌阁",
+	"gen":    "根",
+	"geng":   "耿庚",
+	"gong":   "龚宫公贡",
+	"gou":    "苟",
+	"gu":     "顾古谷辜",
+	"guan":   "关管冠官",
+	"guang":  "光广",
+	"gui":    "桂贵归",
+	"guo":    "郭国果",
+	"hai":    "海",
+	"han":    "韩汉涵寒翰晗含",
+	"hang":   "杭航",
+	"hao":    "郝浩昊豪皓好",
+	"he":     "何贺和河赫荷鹤",
+	"heng":   "衡恒亨",
+	"hong":   "洪红宏鸿弘虹",
+	"hou":    "侯厚",
+	"hu":     "胡虎湖",
+	"hua":    "华花桦",
+	"huai":   "怀",
+	"huan":   "欢桓环焕",
+	"huang":  "黄皇煌",
+	"hui":    "惠慧辉晖回会蕙",
+	"huo":    "霍",
+	"ji":     "纪季姬吉冀继基佶",
+	"jia":    "贾佳嘉家",
+	"jian":   "简建剑坚健鉴",
+	"jiang":  "江姜蒋",
+	"jiao":   "焦娇",
+	"jie":    "杰洁捷婕节解",
+	"jin":    "金晋锦瑾津谨今",
+	"jing":   "井景敬静晶京菁婧靖",
+	"jiu":    "九久",
+	"ju":     "居菊",
+	"juan":   "娟",
+	"jue":    "珏",
+	"jun":    "军君俊骏钧峻",
+	"kai":    "凯开楷",
+	"kan":    "阚",
+	"kang":   "康",
+	"ke":     "柯可克珂科",
+	"kong":   "孔",
+	"kou":    "寇",
+	"kuang":  "匡邝旷",
+	"kun":    "坤昆",
+	"lai":    "来赖莱",
+	"lan":    "兰蓝岚澜",
+	"lang":   "郎朗",
+	"lao":    "劳",
+	"le":     "乐",
+	"lei":    "雷蕾磊",
+	"leng":   "冷",
+	"li":     "李黎丽利立理力励莉礼厉俐",
+	"lian":   "连莲廉",
+	"liang":  "梁良亮",
+	"liao":   "廖辽",
+	"lin":    "林琳霖麟临",
+	"ling":   "凌玲灵岭令翎",
+	"liu":    "刘柳留",
+	"long":   "龙隆",
+	"lou":    "娄楼",
+	"lu":     "卢鲁陆路露璐",
+	"luan":   "栾",
+	"lun":    "伦",
+	"luo":    "罗骆洛",
+	"lv":     "吕律绿",
+	"ma":     "马",
+	"mai":    "麦",
+	"man":    "满曼蔓",
+	"mao":    "毛茅茂",
+	"mei":    "梅美媚玫",
+	"meng":   "孟蒙萌梦",
+	"mi":     "米宓",
+	"miao":   "苗妙淼",
+	"min":    "闵敏民珉",
+	"ming":   "明鸣铭",
+	"mo":     "莫墨默",
+	"mu":     "穆慕牧木沐",
+	"na":     "娜纳",
+	"nan":    "南楠",
+	"ni":     "倪妮霓",
+	"nian":   "年",
+	"ning":   "宁凝",
+	"niu":    "牛",
+	"nong":   "农",
+	"ou":     "欧区",
+	"pan":    "潘盼",
+	"pang":   "庞",
+	"pei":    "裴培佩沛",
+	"peng":   "彭鹏朋蓬",
+	"pi":     "皮",
+	"piao":   "朴飘",
+	"ping":   "平萍屏",
+	"pu":     "蒲浦朴普",
+	"qi":     "齐祁戚琪琦启奇其棋岐",
+	"qian":   "钱倩千谦乾",
+	"qiang":  "强蔷",
+	"qiao":   "乔巧",
+	"qin":    "秦琴勤钦沁覃",
+	"qing":   "青庆清卿晴",
+	"qiong":  "琼",
+	"qiu":    "邱秋丘仇",
+	"qu":     "曲屈瞿区",
+	"quan":   "全权泉",
+	"que":    "阙",
+	"qun":    "群",
+	"ran":    "冉然",
+	"rao":    "饶",
+	"ren":    "任仁",
+	"rong":   "荣容蓉融",
+	"ru":     "如茹汝",
+	"ruan":   "阮",
+	"rui":    "瑞睿蕊锐",
+	"run":    "润",
+	"ruo":    "若",
+	"sa":     "萨",
+	"sai":    "赛",
+	"san":    "三",
+	"sang":   "桑",
+	"sen":    "森",
+	"sha":    "沙莎",
+	"shan":   "单山珊善杉",
+	"shang":  "尚商上",
+	"shao":   "邵少绍韶",
+	"she":    "佘",
+	"shen":   "沈申深慎",
+	"sheng":  "盛生胜圣晟",
+	"shi":    "史石施师诗时世",
+	"shou":   "寿",
+	"shu":    "舒书淑树殊",
+	"shuang": "双爽",
+	"shui":   "水",
+	"shun":   "顺舜",
+	"shuo":   "硕",
+	"si":     "司斯思丝四",
+	"song":   "宋松颂嵩",
+	"su":     "苏素肃",
+	"sui":    "隋",
+	"sun":    "孙",
+	"suo":    "索",
+	"tai":    "太泰",
+	"tan":    "谭覃檀",
+	"tang":   "唐汤棠",
+	"tao":    "陶涛桃韬",
+	"teng":   "滕腾",
+	"tian":   "田天甜",
+	"tie":    "铁",
+	"ting":   "婷庭亭霆",
+	"tong":   "童佟彤桐",
+	"tu":     "涂图屠",
+	"wan":    "万婉宛琬",
+	"wang":   "王汪旺望",
+	"wei":    "魏韦卫伟薇维威蔚巍",
+	"wen":    "温文闻雯",
+	"weng":   "翁",
+	"wu":     "吴武伍吾午舞五",
+	"xi":     "席奚西希熙曦溪喜",
+	"xia":    "夏霞",
+	"xian":   "冼先贤仙娴",
+	"xiang":  "向项香翔祥湘",
+	"xiao":   "肖萧晓笑小",
+	"xie":    "谢解",
+	"xin":    "辛心欣新鑫馨信",
+	"xing":   "邢星兴幸杏",
+	"xiong":  "熊雄",
+	"xiu":    "修秀",
+	"xu":     "许徐胥旭序",
+	"xuan":   "宣轩萱璇玄",
+	"xue":    "薛雪学",
+	"xun":    "荀迅勋",
+	"ya":     "雅亚娅",
+	"yan":    "严颜燕闫晏艳彦岩延言妍",
+	"yang":   "杨阳扬洋",
+	"yao":    "姚尧瑶遥耀",
+	"ye":     "叶业烨",
+	"yi":     "易伊怡逸艺依毅宜一义仪",
+	"yin":    "殷尹银音茵",
+	"ying":   "应英莹颖盈影迎",
+	"yong":   "雍永勇咏",
+	"you":    "尤游友佑优",
+	"yu":     "于余俞虞宇雨玉钰渝瑜煜昱语",
+	"yuan":   "袁元远苑媛源圆原",
+	"yue":    "岳乐越月悦跃",
+	"yun":    "云芸运蕴",
+	"zang":   "臧",
+	"zeng":   "曾增",
+	"zha":    "查",
+	"zhai":   "翟",
+	"zhan":   "詹展湛战",
+	"zhang":  "张章彰",
+	"zhao":   "赵昭钊照朝",
+	"zhe":    "哲浙",
+	"zhen":   "甄珍真振震祯贞",
+	"zheng":  "郑正政峥铮",
+	"zhi":    "智志芝植治知致",
+	"zhong":  "钟仲中忠",
+	"zhou":   "周舟州洲",
+	"zhu":    "朱诸祝竹珠",
+	"zhuang": "庄壮",
+	"zhuo":   "卓",
+	"zi":     "子紫梓姿",
+	"zong":   "宗",
+	"zou":    "邹",
+	"zu":     "祖",
+	"zuo":    "左佐",
+}
+
+// maxPinyinVariants bounds the readings of names with several polyphonic
+// characters.
+const maxPinyinVariants = 4
+
+var pinyinOf = buildPinyinIndex(pinyinSyllables)
+
+func buildPinyinIndex(syllables map[string]string) map[rune][]string {
+	index := make(map[rune][]string)
+	for py, chars := range syllables {
+		for _, c := range chars {
+			index[c] = append(index[c], py)
+		}
+	}
+
+	for _, syllables := range index {
+		sort.Strings(syllables)
+	}
+
+	return index
+}
+
+// namePinyin returns the readings of name, each as the joined syllables and
+// their initials. Letters and digits are kept as is, and other characters
+// are skipped. Names with a Han character of unknown reading have none, so
+// that they only match on their characters rather than on a partial reading.
+func namePinyin(name string) (full, initials []string) {
+	type reading struct{ full, initials string }
+	readings := []reading{{}}
+	found := false
+
+	for _, c := range strings.ToLower(name) {
+		var syllables []string
+		switch {
+		case pinyinOf[c] != nil:
+			syllables = pinyinOf[c]
+			found = true
+		case c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c)):
+			syllables = []string{string(c)}
+		case unicode.Is(unicode.Han, c):
+			return nil, nil
+		default:
+			continue
+		}
+
+		var next []reading
+		for _, r := range readings {
+			for _, py := range syllables {
+				if len(next) == maxPinyinVariants {
+					break
+				}
+
+				next = append(next, reading{r.full + py, r.initials + py[:1]})
+			}
+		}
+
+		readings = next
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	for _, r := range readings {
+		full = append(full, r.full)
+		initials = append(initials, r.initials)
+	}
+
+	return full, initials
+}
@@ -0,0 +1,819 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+	"github.com/ory/hydra/sdk/go/hydra/swagger"
+	"github.com/pragkent/hydra-wework/internal/fsutil"
+	"github.com/pragkent/hydra-wework/wework"
+)
+
+const (
+	pathReviews = "/wework/reviews"
+
+	reviewCheckInterval = time.Hour
+
+	// maxReviewCardNames bounds the names listed on a review card, whose
+	// description is limited to 512 bytes.
+	maxReviewCardNames = 5
+)
+
+type ReviewDecision string
+
+const (
+	ReviewKeep   ReviewDecision = "keep"
+	ReviewRevoke ReviewDecision = "revoke"
+)
+
+// review asks leaders to confirm that members of a hydra group reporting to
+// them still need it. Approvers lists the leaders asked so far, Current the
+// ones the review was last sent or escalated to.
+type review struct {
+	ID          string          `json:"id"`
+	Group       string          `json:"group"`
+	Approvers   []string        `json:"approvers"`
+	Current     []string        `json:"current"`
+	Members     []*reviewMember `json:"members"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Deadline    time.Time       `json:"deadline"`
+	Escalations int             `json:"escalations,omitempty"`
+}
+
+type reviewMember struct {
+	UserID    string         `json:"userid"`
+	Name      string         `json:"name"`
+	Subject   string         `json:"subject"`
+	Decision  ReviewDecision `json:"decision,omitempty"`
+	DecidedBy string         `json:"decided_by,omitempty"`
+	DecidedAt time.Time      `json:"decided_at"`
+}
+
+func (rv *review) member(uid string) *reviewMember {
+	for _, m := range rv.Members {
+		if m.UserID == uid {
+			return m
+		}
+	}
+
+	return nil
+}
+
+func (rv *review) pending() []*reviewMember {
+	var members []*reviewMember
+	for _, m := range rv.Members {
+		if m.Decision == "" {
+			members = append(members, m)
+		}
+	}
+
+	return members
+}
+
+// reviewBook records the reviews in a file, so that rounds and deadlines
+// survive restarts. Replicas may share the file: changes reload it first, and
+// hold a lock on it while they apply and save. mu guards the fields, which
+// are replaced on reload rather than changed in place, so reviews taken out
+// of the book can be read without holding it.
+type reviewBook struct {
+	mu   *sync.Mutex
+	path string
+
+	LastRun time.Time `json:"last_run"`
+	Reviews []*review `json:"reviews"`
+
+	// Retries lists what the round of LastRun failed to review, to retry on
+	// the next checks.
+	Retries []*reviewRetry `json:"retries,omitempty"`
+}
+
+// reviewRetry is a group whose members could not be listed, or only the
+// members of Subjects if set, whose profiles or leaders could not be read.
+type reviewRetry struct {
+	Group    string   `json:"group"`
+	Subjects []string `json:"subjects,omitempty"`
+}
+
+func loadReviewBook(path string) (*reviewBook, error) {
+	b := &reviewBook{mu: &sync.Mutex{}, path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return b, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("read review file error: %v", err)
+	}
+
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal error: %v", err)
+	}
+
+	return b, nil
+}
+
+// reload reads the reviews saved by any replica. b.mu must be held.
+func (b *reviewBook) reload() error {
+	fresh, err := loadReviewBook(b.path)
+	if err != nil {
+		return err
+	}
+
+	b.LastRun, b.Reviews = fresh.LastRun, fresh.Reviews
+	return nil
+}
+
+// save writes the book to its file atomically. b.mu must be held.
+func (b *reviewBook) save() error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return fmt.Errorf("json.Marshal error: %v", err)
+	}
+
+	if err := fsutil.WriteFileAtomic(b.path, data); err != nil {
+		return fmt.Errorf("write review file error: %v", err)
+	}
+
+	return nil
+}
+
+// update reloads the book, applies fn to it and saves it, holding the lock
+// of the file so that replicas do not overwrite each other's changes.
+func (b *reviewBook) update(fn func()) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	lock, err := fsutil.LockFile(b.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("lock review file error: %v", err)
+	}
+
+	defer lock.Close()
+
+	if err := b.reload(); err != nil {
+		return err
+	}
+
+	fn()
+	return b.save()
+}
+
+// lead takes the round lock of the book without blocking, so that one
+// replica at a time checks reviews. It returns nil if another replica holds
+// the lock. Closing the file releases it.
+func (b *reviewBook) lead() (*os.File, error) {
+	return fsutil.TryLockFile(b.path + ".round")
+}
+
+func (b *reviewBook) get(id string) *review {
+	for _, rv := range b.Reviews {
+		if rv.ID == id {
+			return rv
+		}
+	}
+
+	return nil
+}
+
+// reviewRound holds what a check collected from wework and hydra, to merge
+// into the book.
+type reviewRound struct {
+	// LastRun is the start of the round the reviews belong to. New is set if
+	// the check started it, in which case reviews created before
+	// PruneBefore are dropped.
+	LastRun     time.Time
+	New         bool
+	PruneBefore time.Time
+
+	Started     []*review
+	Retries     []*reviewRetry
+	Escalations []*reviewEscalation
+}
+
+// reviewEscalation sends review ID, overdue at Overdue, to Next, or reminds
+// its current approvers if there is nobody above them.
+type reviewEscalation struct {
+	ID       string
+	Overdue  time.Time
+	Next     []string
+	Deadline time.Time
+}
+
+type reviewCard struct {
+	review    *review
+	approvers []string
+	escalated bool
+}
+
+// merge applies round to the book and returns the cards to send. Reviews
+// collected for a round since superseded, and escalations of reviews changed
+// since they were collected, are dropped. b.mu must be held.
+func (b *reviewBook) merge(round *reviewRound) []*reviewCard {
+	var cards []*reviewCard
+
+	if round.New && round.LastRun.After(b.LastRun) {
+		b.LastRun = round.LastRun
+		b.prune(round.PruneBefore)
+	}
+
+	if b.LastRun.Equal(round.LastRun) {
+		b.Reviews = append(b.Reviews, round.Started...)
+		b.Retries = round.Retries
+
+		for _, rv := range round.Started {
+			cards = append(cards, &reviewCard{review: rv, approvers: rv.Current})
+		}
+	}
+
+	for _, e := range round.Escalations {
+		rv := b.get(e.ID)
+		if rv == nil || !rv.Deadline.Equal(e.Overdue) || len(rv.pending()) == 0 {
+			continue
+		}
+
+		rv.Deadline = e.Deadline
+		if len(e.Next) == 0 {
+			glog.Warningf("Review %v of group %v is overdue with nobody to escalate to. Reminding %v", rv.ID, rv.Group, rv.Current)
+			cards = append(cards, &reviewCard{review: rv, approvers: rv.Current})
+			continue
+		}
+
+		glog.Infof("Review %v of group %v is overdue. Escalating to %v", rv.ID, rv.Group, e.Next)
+		rv.Approvers = append(rv.Approvers, e.Next...)
+		rv.Current = e.Next
+		rv.Escalations++
+		cards = append(cards, &reviewCard{review: rv, approvers: e.Next, escalated: true})
+	}
+
+	return cards
+}
+
+// prune drops the reviews created before t, which later rounds superseded.
+// b.mu must be held.
+func (b *reviewBook) prune(t time.Time) {
+	var kept []*review
+	for _, rv := range b.Reviews {
+		if !rv.CreatedAt.Before(t) {
+			kept = append(kept, rv)
+		}
+	}
+
+	b.Reviews = kept
+}
+
+// decide records decision on member uid of review id by approver, and
+// returns whether it did, false if the member was decided already.
+func (b *reviewBook) decide(id, uid string, decision ReviewDecision, approver string) (bool, error) {
+	var won bool
+	err := b.update(func() {
+		m := b.member(id, uid)
+		if m == nil || m.Decision != "" {
+			return
+		}
+
+		m.Decision = decision
+		m.DecidedBy = approver
+		m.DecidedAt = time.Now()
+		won = true
+	})
+
+	return won && err == nil, err
+}
+
+// undecide clears decision on member uid of review id by approver, recorded
+// by decide, unless it was changed since.
+func (b *reviewBook) undecide(id, uid string, decision ReviewDecision, approver string) error {
+	return b.update(func() {
+		m := b.member(id, uid)
+		if m == nil || m.Decision != decision || m.DecidedBy != approver {
+			return
+		}
+
+		m.Decision = ""
+		m.DecidedBy = ""
+		m.DecidedAt = time.Time{}
+	})
+}
+
+// member returns member uid of review id, or nil. b.mu must be held.
+func (b *reviewBook) member(id, uid string) *reviewMember {
+	rv := b.get(id)
+	if rv == nil {
+		return nil
+	}
+
+	return rv.member(uid)
+}
+
+// reviewLoop starts a round of reviews every ReviewInterval and escalates
+// overdue ones.
+func (s *Server) reviewLoop() {
+	ticker := time.NewTicker(reviewCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.checkReviews()
+
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkReviews collects a round from the saved reviews without holding the
+// book, merges it and sends the cards. Replicas sharing the review file take
+// turns, so leaders are not sent a card per replica.
+func (s *Server) checkReviews() {
+	ctx, cancel := context.WithTimeout(context.Background(), reviewCheckInterval)
+	defer cancel()
+
+	lock, err := s.reviews.lead()
+	if err != nil {
+		glog.Errorf("Lock reviews failed. %v", err)
+		return
+	}
+
+	if lock == nil {
+		glog.V(1).Infof("Reviews are being checked by another replica")
+		return
+	}
+
+	defer lock.Close()
+
+	saved, err := loadReviewBook(s.reviews.path)
+	if err != nil {
+		glog.Errorf("Load reviews failed. %v", err)
+		return
+	}
+
+	now := time.Now()
+	round := &reviewRound{LastRun: saved.LastRun, Retries: saved.Retries}
+	if now.Sub(saved.LastRun) >= s.cfg.ReviewInterval {
+		glog.Infof("Starting access reviews of groups %v", s.reviewGroups())
+
+		round.LastRun = now
+		round.New = true
+		round.PruneBefore = now.Add(-2 * s.cfg.ReviewInterval)
+		round.Retries = nil
+		for _, group := range s.reviewGroups() {
+			round.Started, round.Retries = s.startReviews(ctx, now, &reviewRetry{Group: group}, nil, round.Started, round.Retries)
+		}
+	} else {
+		round.Retries = nil
+		for _, retry := range saved.Retries {
+			glog.Infof("Retrying access reviews of group %v %v", retry.Group, retry.Subjects)
+			round.Started, round.Retries = s.startReviews(ctx, now, retry, saved.reviewed(retry.Group), round.Started, round.Retries)
+		}
+
+		round.Escalations = s.escalateReviews(ctx, saved)
+	}
+
+	var cards []*reviewCard
+	if err := s.reviews.update(func() { cards = s.reviews.merge(round) }); err != nil {
+		glog.Errorf("Save reviews failed. %v", err)
+		return
+	}
+
+	for _, c := range cards {
+		s.sendReview(ctx, c.review, c.approvers, c.escalated)
+	}
+}
+
+// reviewGroups returns the groups to review: ReviewGroups, or else the
+// groups of ClientGroups.
+func (s *Server) reviewGroups() []string {
+	if len(s.cfg.ReviewGroups) > 0 {
+		return s.cfg.ReviewGroups
+	}
+
+	var groups []string
+	for _, g := range s.cfg.ClientGroups {
+		if !contains(groups, g) {
+			groups = append(groups, g)
+		}
+	}
+
+	sort.Strings(groups)
+	return groups
+}
+
+// reviewed returns the subjects of group in reviews of the round of
+// b.LastRun.
+func (b *reviewBook) reviewed(group string) map[string]bool {
+	subjects := make(map[string]bool)
+	for _, rv := range b.Reviews {
+		if rv.Group != group || rv.CreatedAt.Before(b.LastRun) {
+			continue
+		}
+
+		for _, m := range rv.Members {
+			subjects[m.Subject] = true
+		}
+	}
+
+	return subjects
+}
+
+// startReviews appends to started reviews asking every leader about the
+// members of target reporting to them, skipping the subjects reviewed
+// already. Members who left the corp are revoked right away. What fails to
+// be read is appended to retries.
+func (s *Server) startReviews(ctx context.Context, now time.Time, target *reviewRetry, reviewed map[string]bool, started []*review, retries []*reviewRetry) ([]*review, []*reviewRetry) {
+	group := target.Group
+	members := target.Subjects
+	if len(members) == 0 {
+		var err error
+		members, err = s.groupMembers(group)
+		if err != nil {
+			glog.Errorf("Get members of group %v failed. %v", group, err)
+			return started, append(retries, &reviewRetry{Group: group})
+		}
+	}
+
+	byLeaders := make(map[string]*review)
+	failed := &reviewRetry{Group: group}
+
+	for _, subject := range members {
+		if reviewed[subject] {
+			continue
+		}
+
+		uid, ok := memberUserID(subject)
+		if !ok {
+			glog.V(1).Infof("Skipping review of %v in group %v", subject, group)
+			continue
+		}
+
+		userResp, err := s.wcli.GetUserContext(ctx, uid)
+		if wework.IsNotFound(err) {
+			glog.Infof("Revoking group %v of wework user %v, who left the corp", group, uid)
+			if err := s.removeGroupMember(group, subject); err != nil {
+				glog.Errorf("Remove %v from group %v failed. %v", subject, group, err)
+				failed.Subjects = append(failed.Subjects, subject)
+			}
+			continue
+		}
+
+		if err != nil {
+			glog.Errorf("Get user %v failed. %v", uid, err)
+			failed.Subjects = append(failed.Subjects, subject)
+			continue
+		}
+
+		leaders, err := s.leadersOf(ctx, &userResp.User)
+		if err == errNoApprover {
+			glog.Warningf("Skipping review of %v in group %v. No leader to review it", uid, group)
+			continue
+		}
+
+		if err != nil {
+			glog.Errorf("Get leaders of %v failed. %v", uid, err)
+			failed.Subjects = append(failed.Subjects, subject)
+			continue
+		}
+
+		key := strings.Join(leaders, ",")
+		rv := byLeaders[key]
+		if rv == nil {
+			rv = &review{
+				ID:        newRandomID(),
+				Group:     group,
+				Approvers: append([]string(nil), leaders...),
+				Current:   leaders,
+				CreatedAt: now,
+				Deadline:  now.Add(s.cfg.ReviewDeadline),
+			}
+			byLeaders[key] = rv
+			started = append(started, rv)
+		}
+
+		rv.Members = append(rv.Members, &reviewMember{UserID: uid, Name: userResp.User.Name, Subject: subject})
+	}
+
+	if len(failed.Subjects) > 0 {
+		retries = append(retries, failed)
+	}
+
+	return started, retries
+}
+
+// escalateReviews returns the escalations of the overdue reviews of b to the
+// leaders of the leaders last asked. Reviews of past rounds are left as is.
+func (s *Server) escalateReviews(ctx context.Context, b *reviewBook) []*reviewEscalation {
+	now := time.Now()
+
+	var escalations []*reviewEscalation
+	for _, rv := range b.Reviews {
+		if rv.CreatedAt.Before(b.LastRun) || len(rv.pending()) == 0 || now.Before(rv.Deadline) {
+			continue
+		}
+
+		var next []string
+		for _, uid := range rv.Current {
+			userResp, err := s.wcli.GetUserContext(ctx, uid)
+			if err != nil {
+				glog.Errorf("Get user %v failed. %v", uid, err)
+				continue
+			}
+
+			leaders, err := s.leadersOf(ctx, &userResp.User)
+			if err != nil && err != errNoApprover {
+				glog.Errorf("Get leaders of %v failed. %v", uid, err)
+				continue
+			}
+
+			for _, l := range leaders {
+				if !contains(rv.Approvers, l) && !contains(next, l) {
+					next = append(next, l)
+				}
+			}
+		}
+
+		escalations = append(escalations, &reviewEscalation{
+			ID:       rv.ID,
+			Overdue:  rv.Deadline,
+			Next:     next,
+			Deadline: now.Add(s.cfg.ReviewDeadline),
+		})
+	}
+
+	return escalations
+}
+
+// sendReview messages each of approvers a card linking to the review page.
+func (s *Server) sendReview(ctx context.Context, rv *review, approvers []string, escalated bool) {
+	var names []string
+	for _, m := range rv.pending() {
+		names = append(names, m.Name)
+	}
+
+	if len(names) > maxReviewCardNames {
+		names = append(names[:maxReviewCardNames], fmt.Sprintf("and %d more", len(names)-maxReviewCardNames))
+	}
+
+	title := "Access review: " + rv.Group
+	if escalated {
+		title = "Overdue access review: " + rv.Group
+	}
+
+	for _, uid := range approvers {
+		card := wework.TextCardContent{
+			Title: title,
+			Description: fmt.Sprintf(
+				`<div class="gray">Due %s</div><div class="normal">Confirm who still needs group %s:</div><div class="highlight">%s</div>`,
+				rv.Deadline.Format("2006-01-02"), template.HTMLEscapeString(rv.Group), template.HTMLEscapeString(strings.Join(names, ", "))),
+			URL:        s.reviewURL(rv, uid),
+			ButtonText: "Review",
+		}
+
+		resp, err := s.wcli.SendMessageContext(ctx, wework.NewTextCardMessage(card, uid))
+		if err != nil {
+			glog.Errorf("Send review %v to %v failed. %v", rv.ID, uid, err)
+			continue
+		}
+
+		if resp.InvalidUser != "" {
+			glog.Warningf("Send review %v to %v failed. Invalid user: %v", rv.ID, uid, resp.InvalidUser)
+		}
+	}
+}
+
+// reviewURL returns the link of approver to the review page, signed with
+// ReviewSecret. It expires a deadline after the review is due.
+func (s *Server) reviewURL(rv *review, approver string) string {
+	expires := rv.Deadline.Add(s.cfg.ReviewDeadline).Unix()
+
+	q := url.Values{}
+	q.Set("approver", approver)
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("sig", s.reviewSignature(rv.ID, approver, expires))
+
+	return externalURL(s.cfg.HTTPS, s.cfg.PublicHost, pathReviews+"/"+rv.ID) + "?" + q.Encode()
+}
+
+func (s *Server) reviewSignature(id, approver string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(s.cfg.ReviewSecret))
+	fmt.Fprintf(mac, "%s\n%s\n%d", id, approver, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// reviewApprover returns the approver the link of r to review id was signed
+// for, or an empty string if it is forged or expired.
+func (s *Server) reviewApprover(r *http.Request, id string) string {
+	q := r.URL.Query()
+	approver := q.Get("approver")
+
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil || approver == "" || time.Now().Unix() > expires {
+		return ""
+	}
+
+	sig := s.reviewSignature(id, approver, expires)
+	if !hmac.Equal([]byte(sig), []byte(q.Get("sig"))) {
+		return ""
+	}
+
+	return approver
+}
+
+var reviewTemplate = template.Must(template.New("review").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Access review</title>
+<style>
+body { font-family: sans-serif; margin: 24px; color: #333; }
+table { border-collapse: collapse; width: 100%; }
+td { padding: 8px 4px; border-bottom: 1px solid #eee; }
+form { display: inline; }
+.gray { color: #999; }
+</style>
+</head>
+<body>
+<h2>Access review: {{.Group}}</h2>
+<p class="gray">Due {{.Deadline.Format "2006-01-02"}}. Revoked members lose access to the clients requiring the group.</p>
+<table>
+{{range .Members}}
+<tr>
+<td>{{.Name}} <span class="gray">{{.UserID}}</span></td>
+<td>
+{{if .Decision}}
+{{.Decision}} <span class="gray">by {{.DecidedBy}}</span>
+{{else}}
+<form method="post" action="{{$.Path}}/{{.UserID}}/keep?{{$.Query}}"><button type="submit">Keep</button></form>
+<form method="post" action="{{$.Path}}/{{.UserID}}/revoke?{{$.Query}}"><button type="submit">Revoke</button></form>
+{{end}}
+</td>
+</tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
+
+type reviewPage struct {
+	*review
+	Path  string
+	Query template.URL
+}
+
+// ReviewHandler shows a review to an approver, through a signed link.
+func (s *Server) ReviewHandler(w http.ResponseWriter, r *http.Request) {
+	rv, _ := s.authorizeReview(w, r)
+	if rv == nil {
+		return
+	}
+
+	page := &reviewPage{
+		review: rv,
+		Path:   pathReviews + "/" + rv.ID,
+		Query:  template.URL(r.URL.RawQuery),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := reviewTemplate.Execute(w, page); err != nil {
+		glog.Errorf("Render review page failed. %v", err)
+	}
+}
+
+// ReviewDecisionHandler keeps or revokes a member under review.
+func (s *Server) ReviewDecisionHandler(w http.ResponseWriter, r *http.Request) {
+	rv, approver := s.authorizeReview(w, r)
+	if rv == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	m := rv.member(vars["uid"])
+	if m == nil {
+		renderMessage(w, http.StatusNotFound, "Member not found", "The member is not part of the review.")
+		return
+	}
+
+	decision := ReviewDecision(vars["action"])
+	won, err := s.reviews.decide(rv.ID, m.UserID, decision, approver)
+	if err != nil {
+		glog.Errorf("Save reviews failed. %v", err)
+		http.Error(w, "Save review error", http.StatusInternalServerError)
+		return
+	}
+
+	if won {
+		if decision == ReviewRevoke {
+			if err := s.removeGroupMember(rv.Group, m.Subject); err != nil {
+				glog.Errorf("Remove %v from group %v failed. %v", m.Subject, rv.Group, err)
+				if err := s.reviews.undecide(rv.ID, m.UserID, decision, approver); err != nil {
+					glog.Errorf("Save reviews failed. %v", err)
+				}
+
+				http.Error(w, "Revoke access error", http.StatusBadGateway)
+				return
+			}
+		}
+
+		glog.Infof("Review %v: %v %v in group %v by %v", rv.ID, decision, m.UserID, rv.Group, approver)
+	}
+
+	http.Redirect(w, r, pathReviews+"/"+rv.ID+"?"+r.URL.RawQuery, http.StatusSeeOther)
+}
+
+// authorizeReview returns the latest saved review of r and the approver of
+// its signed link, or writes an error and returns nil.
+func (s *Server) authorizeReview(w http.ResponseWriter, r *http.Request) (*review, string) {
+	id := mux.Vars(r)["id"]
+
+	approver := s.reviewApprover(r, id)
+	if approver == "" {
+		renderMessage(w, http.StatusForbidden, "Link expired", "The review link is invalid or has expired.")
+		return nil, ""
+	}
+
+	s.reviews.mu.Lock()
+	defer s.reviews.mu.Unlock()
+
+	if err := s.reviews.reload(); err != nil {
+		glog.Errorf("Load reviews failed. %v", err)
+		http.Error(w, "Load reviews error", http.StatusInternalServerError)
+		return nil, ""
+	}
+
+	rv := s.reviews.get(id)
+	if rv == nil || !contains(rv.Approvers, approver) {
+		renderMessage(w, http.StatusNotFound, "Review not found", "The review does not exist.")
+		return nil, ""
+	}
+
+	return rv, approver
+}
+
+func (s *Server) groupMembers(group string) ([]string, error) {
+	g, response, err := s.hcli.GetGroup(group)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get group unexpected http status: %v", response.Status)
+	}
+
+	return g.Members, nil
+}
+
+func (s *Server) removeGroupMember(group, subject string) error {
+	response, err := s.hcli.RemoveMembersFromGroup(group, swagger.GroupMembers{Members: []string{subject}})
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("remove group members unexpected http status: %v", response.Status)
+	}
+
+	return nil
+}
+
+// memberUserID returns the uid of a member subject of the corp. Subjects of
+// external users and of other corps are not reviewed.
+func memberUserID(subject string) (string, bool) {
+	if !strings.HasPrefix(subject, "user:") {
+		return "", false
+	}
+
+	uid := strings.TrimPrefix(subject, "user:")
+	if uid == "" || strings.Contains(uid, ":") {
+		return "", false
+	}
+
+	return uid, true
+}
+
+// newRandomID returns a random hex id, e.g. of a review or an oauth state.
+func newRandomID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand error: %v", err))
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,297 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func tempReviewBook(t *testing.T) (*reviewBook, func()) {
+	dir, err := ioutil.TempDir("", "reviews")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := loadReviewBook(filepath.Join(dir, "reviews.json"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return b, func() { os.RemoveAll(dir) }
+}
+
+func TestReviewBookMerge(t *testing.T) {
+	now := time.Now().Round(time.Second)
+	overdue := now.Add(-time.Hour)
+
+	newBook := func() *reviewBook {
+		return &reviewBook{
+			Reviews: []*review{
+				{ID: "r1", Group: "ops", Current: []string{"lisi"}, Approvers: []string{"lisi"}, Deadline: overdue,
+					Members: []*reviewMember{{UserID: "zhangsan"}}},
+				{ID: "r2", Group: "ops", Current: []string{"wangwu"}, Approvers: []string{"wangwu"}, Deadline: overdue,
+					Members: []*reviewMember{{UserID: "zhaoliu", Decision: ReviewKeep}}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		round     *reviewRound
+		cards     int
+		current   []string
+		deadline  time.Time
+		escalated bool
+	}{
+		{
+			name:      "escalate",
+			round:     &reviewRound{Escalations: []*reviewEscalation{{ID: "r1", Overdue: overdue, Next: []string{"boss"}, Deadline: now}}},
+			cards:     1,
+			current:   []string{"boss"},
+			deadline:  now,
+			escalated: true,
+		},
+		{
+			name:     "remind",
+			round:    &reviewRound{Escalations: []*reviewEscalation{{ID: "r1", Overdue: overdue, Deadline: now}}},
+			cards:    1,
+			current:  []string{"lisi"},
+			deadline: now,
+		},
+		{
+			name:     "escalated by another replica",
+			round:    &reviewRound{Escalations: []*reviewEscalation{{ID: "r1", Overdue: overdue.Add(-time.Hour), Next: []string{"boss"}, Deadline: now}}},
+			current:  []string{"lisi"},
+			deadline: overdue,
+		},
+		{
+			name:     "decided since",
+			round:    &reviewRound{Escalations: []*reviewEscalation{{ID: "r2", Overdue: overdue, Next: []string{"boss"}, Deadline: now}}},
+			current:  []string{"lisi"},
+			deadline: overdue,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBook()
+			cards := b.merge(tt.round)
+			if len(cards) != tt.cards {
+				t.Fatalf("cards = %+v, want %d", cards, tt.cards)
+			}
+
+			if len(cards) > 0 && cards[0].escalated != tt.escalated {
+				t.Errorf("escalated = %v, want %v", cards[0].escalated, tt.escalated)
+			}
+
+			rv := b.get("r1")
+			if len(rv.Current) != len(tt.current) || rv.Current[0] != tt.current[0] {
+				t.Errorf("Current = %v, want %v", rv.Current, tt.current)
+			}
+
+			if !rv.Deadline.Equal(tt.deadline) {
+				t.Errorf("Deadline = %v, want %v", rv.Deadline, tt.deadline)
+			}
+		})
+	}
+
+}
+
+func TestReviewBookMergeRound(t *testing.T) {
+	now := time.Now().Round(time.Second)
+	lastRun := now.Add(-time.Hour)
+
+	newBook := func() *reviewBook {
+		return &reviewBook{
+			LastRun: lastRun,
+			Reviews: []*review{
+				{ID: "old", Group: "ops", CreatedAt: now.Add(-72 * time.Hour)},
+				{ID: "r1", Group: "ops", CreatedAt: lastRun},
+			},
+			Retries: []*reviewRetry{{Group: "dev"}},
+		}
+	}
+
+	started := []*review{{ID: "r2", Group: "dev", Current: []string{"lisi"}, CreatedAt: now}}
+
+	tests := []struct {
+		name    string
+		round   *reviewRound
+		cards   int
+		reviews []string
+		retries int
+		lastRun time.Time
+	}{
+		{
+			name:    "new round",
+			round:   &reviewRound{LastRun: now, New: true, PruneBefore: now.Add(-48 * time.Hour), Started: started, Retries: []*reviewRetry{{Group: "qa"}}},
+			cards:   1,
+			reviews: []string{"r1", "r2"},
+			retries: 1,
+			lastRun: now,
+		},
+		{
+			name:    "retried",
+			round:   &reviewRound{LastRun: lastRun, Started: started},
+			cards:   1,
+			reviews: []string{"old", "r1", "r2"},
+			lastRun: lastRun,
+		},
+		{
+			name:    "retried for a superseded round",
+			round:   &reviewRound{LastRun: lastRun.Add(-24 * time.Hour), Started: started},
+			reviews: []string{"old", "r1"},
+			retries: 1,
+			lastRun: lastRun,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBook()
+			cards := b.merge(tt.round)
+			if len(cards) != tt.cards {
+				t.Fatalf("cards = %+v, want %d", cards, tt.cards)
+			}
+
+			var ids []string
+			for _, rv := range b.Reviews {
+				ids = append(ids, rv.ID)
+			}
+
+			if !reflect.DeepEqual(ids, tt.reviews) {
+				t.Errorf("reviews = %v, want %v", ids, tt.reviews)
+			}
+
+			if len(b.Retries) != tt.retries {
+				t.Errorf("retries = %+v, want %d", b.Retries, tt.retries)
+			}
+
+			if !b.LastRun.Equal(tt.lastRun) {
+				t.Errorf("LastRun = %v, want %v", b.LastRun, tt.lastRun)
+			}
+		})
+	}
+}
+
+func TestReviewBookReviewed(t *testing.T) {
+	now := time.Now()
+	b := &reviewBook{
+		LastRun: now,
+		Reviews: []*review{
+			{Group: "ops", CreatedAt: now.Add(-time.Hour), Members: []*reviewMember{{Subject: "old"}}},
+			{Group: "ops", CreatedAt: now, Members: []*reviewMember{{Subject: "zhangsan"}}},
+			{Group: "dev", CreatedAt: now, Members: []*reviewMember{{Subject: "lisi"}}},
+		},
+	}
+
+	want := map[string]bool{"zhangsan": true}
+	if got := b.reviewed("ops"); !reflect.DeepEqual(got, want) {
+		t.Errorf("reviewed = %v, want %v", got, want)
+	}
+}
+
+func TestReviewBookUpdateKeepsOtherReplicas(t *testing.T) {
+	b, cleanup := tempReviewBook(t)
+	defer cleanup()
+
+	err := b.update(func() {
+		b.Reviews = []*review{{ID: "r1", Members: []*reviewMember{{UserID: "zhangsan"}, {UserID: "lisi"}}}}
+	})
+
+	if err != nil {
+		t.Fatalf("update error: %v", err)
+	}
+
+	other, err := loadReviewBook(b.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := other.update(func() { other.get("r1").member("zhangsan").Decision = ReviewKeep }); err != nil {
+		t.Fatalf("update of other replica error: %v", err)
+	}
+
+	if err := b.update(func() { b.get("r1").member("lisi").Decision = ReviewRevoke }); err != nil {
+		t.Fatalf("update error: %v", err)
+	}
+
+	saved, err := loadReviewBook(b.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rv := saved.get("r1")
+	if rv.member("zhangsan").Decision != ReviewKeep || rv.member("lisi").Decision != ReviewRevoke {
+		t.Errorf("saved members = %+v %+v, want both decisions", rv.member("zhangsan"), rv.member("lisi"))
+	}
+}
+
+func TestReviewBookLead(t *testing.T) {
+	b, cleanup := tempReviewBook(t)
+	defer cleanup()
+
+	lock, err := b.lead()
+	if err != nil || lock == nil {
+		t.Fatalf("lead = %v, %v, want the lock", lock, err)
+	}
+
+	if other, err := b.lead(); other != nil || err != nil {
+		t.Errorf("lead while held = %v, %v, want nil", other, err)
+	}
+
+	lock.Close()
+
+	other, err := b.lead()
+	if err != nil || other == nil {
+		t.Fatalf("lead after release = %v, %v, want the lock", other, err)
+	}
+
+	other.Close()
+}
+
+func TestReviewBookDecide(t *testing.T) {
+	b, cleanup := tempReviewBook(t)
+	defer cleanup()
+
+	err := b.update(func() {
+		b.Reviews = []*review{{ID: "r1", Members: []*reviewMember{{UserID: "zhangsan"}}}}
+	})
+
+	if err != nil {
+		t.Fatalf("update error: %v", err)
+	}
+
+	other, err := loadReviewBook(b.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if won, err := b.decide("r1", "zhangsan", ReviewRevoke, "lisi"); !won || err != nil {
+		t.Fatalf("decide = %v, %v, want won", won, err)
+	}
+
+	if won, err := other.decide("r1", "zhangsan", ReviewKeep, "wangwu"); won || err != nil {
+		t.Errorf("decide of decided member = %v, %v, want lost", won, err)
+	}
+
+	if err := other.undecide("r1", "zhangsan", ReviewKeep, "wangwu"); err != nil {
+		t.Fatalf("undecide error: %v", err)
+	}
+
+	if m := other.get("r1").member("zhangsan"); m.Decision != ReviewRevoke {
+		t.Errorf("decision after undecide of another = %+v, want kept", m)
+	}
+
+	if err := b.undecide("r1", "zhangsan", ReviewRevoke, "lisi"); err != nil {
+		t.Fatalf("undecide error: %v", err)
+	}
+
+	if won, err := other.decide("r1", "zhangsan", ReviewKeep, "wangwu"); !won || err != nil {
+		t.Errorf("decide after undecide = %v, %v, want won", won, err)
+	}
+}
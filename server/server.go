@@ -1,7 +1,8 @@
 package server
 
 import (
-	"errors"
+	"context"
+	"crypto/sha256"
 	"fmt"
 	"net"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 	"github.com/ory/hydra/sdk/go/hydra"
 	"github.com/ory/hydra/sdk/go/hydra/swagger"
 	"github.com/pragkent/hydra-wework/wework"
+	"github.com/pragkent/hydra-wework/wework/crypto"
 )
 
 const (
@@ -22,14 +24,31 @@ const (
 	pathConsent  = "/wework/consent"
 	pathAuth     = "/wework/auth"
 	pathCallback = "/wework/callback"
+
+	// groupsPageSize is the number of warden groups listed per request.
+	groupsPageSize = 100
 )
 
 type Server struct {
-	cfg   *Config
-	mux   *mux.Router
-	hcli  hydra.SDK
-	wcli  *wework.Client
-	store sessions.Store
+	cfg            *Config
+	mux            *mux.Router
+	hcli           hydra.SDK
+	wcli           *wework.Client
+	pcli           *wework.ProviderClient
+	visibility     *wework.VisibleRangeCache
+	replica        *wework.Replica
+	auth           authenticator
+	store          sessions.Store
+	msgCrypt       *crypto.MsgCrypt
+	suiteCrypt     *crypto.MsgCrypt
+	hooks          []EventHook
+	events         chan *wework.Event
+	joins          JoinRequestStore
+	people         *peopleDirectory
+	access         AccessRequestStore
+	reviews        *reviewBook
+	trustedProxies []*net.IPNet
+	closed         chan struct{}
 }
 
 func New(c *Config) (*Server, error) {
@@ -37,41 +56,201 @@ func New(c *Config) (*Server, error) {
 		ClientID:     c.HydraClientID,
 		ClientSecret: c.HydraClientSecret,
 		EndpointURL:  c.HydraURL,
-		Scopes:       []string{"hydra.consent", "hydra.warden.groups"},
+		Scopes:       hydraScopes(c),
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	store := sessions.NewCookieStore([]byte(c.CookieSecret))
+	opts, err := weworkOptions(c)
+	if err != nil {
+		return nil, err
+	}
+
+	trustedProxies, err := parseNetworks(c.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	store := sessions.NewCookieStore(cookieKeys(c.CookieSecret))
 	store.MaxAge(86400)
 
 	srv := &Server{
-		cfg:   c,
-		mux:   mux.NewRouter(),
-		hcli:  hcli,
-		wcli:  wework.NewClient(c.WeworkCorpID, c.WeworkAgentID, c.WeworkSecret),
-		store: store,
+		cfg:            c,
+		mux:            mux.NewRouter(),
+		hcli:           hcli,
+		store:          store,
+		trustedProxies: trustedProxies,
+		events:         make(chan *wework.Event, eventQueueSize),
+		closed:         make(chan struct{}),
+	}
+
+	if c.ProviderMode() {
+		srv.pcli = wework.NewProviderClient(c.WeworkCorpID, c.WeworkProviderSecret, c.WeworkSuiteID, c.WeworkSuiteSecret, opts...)
+		srv.auth = &providerAuthenticator{srv.pcli}
+	} else {
+		opts = append(opts,
+			wework.WithCredential(wework.CredentialContacts, c.WeworkContactsSecret),
+			wework.WithCredential(wework.CredentialApproval, c.WeworkApprovalSecret))
+		srv.wcli = wework.NewClient(c.WeworkCorpID, c.WeworkAgentID, c.WeworkSecret, opts...)
+		srv.visibility = wework.NewVisibleRangeCache(srv.wcli, c.WeworkAgentID, c.WeworkVisibleRangeTTL)
+
+		if c.DirectorySyncInterval > 0 {
+			srv.replica = wework.NewReplica(srv.wcli, c.DirectorySnapshot, c.DirectorySyncInterval)
+			srv.replica.OnChange(logDirectoryChanges)
+		}
+		srv.auth = &corpAuthenticator{wcli: srv.wcli, external: c.ExternalLogin}
+
+		if c.AccessRequests {
+			srv.access, err = NewFileAccessRequestStore(c.AccessRequestDir)
+			if err != nil {
+				return nil, err
+			}
+
+			srv.mux.HandleFunc(pathAccessRequests, srv.AccessRequestHandler).Methods(http.MethodPost)
+		}
+
+		if c.ReviewInterval > 0 {
+			srv.reviews, err = loadReviewBook(c.ReviewFile)
+			if err != nil {
+				return nil, err
+			}
+
+			srv.mux.HandleFunc(pathReviews+"/{id}", srv.ReviewHandler).Methods(http.MethodGet)
+			srv.mux.HandleFunc(pathReviews+"/{id}/{uid}/{action:keep|revoke}", srv.ReviewDecisionHandler).Methods(http.MethodPost)
+		}
+
+		if c.PeopleAPI {
+			srv.people = newPeopleDirectory(srv.wcli, srv.replica, c.DirectoryMaxStaleness, c.PeopleTTL)
+			srv.mux.HandleFunc(pathPeople, srv.PeopleHandler).Methods(http.MethodGet)
+		}
 	}
 
 	srv.mux.HandleFunc(pathConsent, srv.ConsentHandler)
 	srv.mux.HandleFunc(pathAuth, srv.AuthHandler)
 	srv.mux.HandleFunc(pathCallback, srv.CallbackHandler)
 
+	if c.WeworkCallbackToken != "" {
+		srv.msgCrypt, err = crypto.New(c.WeworkCallbackToken, c.WeworkCallbackAESKey, c.WeworkCorpID)
+		if err != nil {
+			return nil, err
+		}
+
+		if !c.ProviderMode() {
+			srv.AddEventHook(EventHookFunc(srv.revokeDepartures))
+		}
+
+		if srv.visibility != nil {
+			srv.AddEventHook(EventHookFunc(srv.invalidateVisibility))
+		}
+
+		if srv.replica != nil {
+			srv.AddEventHook(EventHookFunc(srv.syncReplica))
+		}
+
+		if srv.access != nil {
+			srv.AddEventHook(EventHookFunc(srv.handleApprovalChange))
+		}
+
+		srv.mux.HandleFunc(pathEvents, srv.EventsHandler)
+	}
+
+	if c.WeworkSuiteCallbackToken != "" {
+		srv.suiteCrypt, err = crypto.New(c.WeworkSuiteCallbackToken, c.WeworkSuiteCallbackAESKey, c.WeworkSuiteID)
+		if err != nil {
+			return nil, err
+		}
+
+		srv.mux.HandleFunc(pathSuiteEvents, srv.SuiteEventsHandler)
+	}
+
+	if c.SecondaryVerify {
+		srv.mux.HandleFunc(pathVerify, srv.VerifyHandler).Methods(http.MethodGet)
+
+		if c.VerifyApproval {
+			srv.joins, err = NewFileJoinRequestStore(c.VerifyRequestDir)
+			if err != nil {
+				return nil, err
+			}
+
+			srv.mux.HandleFunc(pathVerifyRequests, srv.JoinRequestsHandler).Methods(http.MethodGet)
+			srv.mux.HandleFunc(pathVerifyRequests+"/{uid}/{action:approve|reject}", srv.JoinDecisionHandler).Methods(http.MethodPost)
+		}
+	}
+
 	return srv, nil
 }
 
+func weworkOptions(c *Config) ([]wework.Option, error) {
+	retry := wework.DefaultRetryPolicy
+	retry.MaxRetries = c.WeworkMaxRetries
+
+	opts := []wework.Option{
+		wework.WithBaseURL(c.WeworkAPIURL),
+		wework.WithHTTPClient(&http.Client{Timeout: c.WeworkTimeout}),
+		wework.WithTokenRefreshRatio(c.WeworkTokenRatio),
+		wework.WithRetryPolicy(retry),
+		wework.WithRateLimit(c.WeworkRateLimit),
+		wework.WithOAuthScope(c.WeworkOAuthScope),
+	}
+
+	for path, perMinute := range c.WeworkEndpointRateLimits {
+		opts = append(opts, wework.WithEndpointRateLimit(path, perMinute))
+	}
+
+	if c.WeworkTokenDir != "" {
+		ts, err := wework.NewFileTokenStore(c.WeworkTokenDir)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, wework.WithTokenStore(ts))
+	}
+
+	return opts, nil
+}
+
 func (s *Server) ListenAndServe() error {
 	lis, err := net.Listen("tcp", s.cfg.BindAddr)
 	if err != nil {
 		return err
 	}
 
+	if s.replica != nil {
+		s.replica.Start()
+	}
+
+	if s.msgCrypt != nil {
+		go s.eventLoop()
+	}
+
+	if s.access != nil {
+		go s.pollAccessRequests()
+	}
+
+	if s.reviews != nil {
+		go s.reviewLoop()
+	}
+
 	glog.Infof("Listening on %v", lis.Addr())
 	return http.Serve(lis, s.mux)
 }
 
+func (s *Server) Close() error {
+	close(s.closed)
+
+	if s.replica != nil {
+		s.replica.Close()
+	}
+
+	if s.pcli != nil {
+		return s.pcli.Close()
+	}
+
+	return s.wcli.Close()
+}
+
 func (s *Server) ConsentHandler(w http.ResponseWriter, r *http.Request) {
 	reqID := consentID(r)
 	if reqID == "" {
@@ -93,25 +272,43 @@ func (s *Server) ConsentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session := s.session(r)
-	uid, ok := session.Values["uid"].(string)
-	if !ok || uid == "" {
+	id := loadIdentity(s.session(r))
+	if id == nil {
 		glog.Errorf("User not signed in")
 		http.Redirect(w, r, getAuthURL(consentID(r)), http.StatusFound)
 		return
 	}
 
-	extraVars, err := s.getTokenVars(uid)
+	if id.external() && !contains(s.cfg.ExternalLoginClients, request.ClientId) {
+		s.rejectConsent(w, r, request, denialReason(errExternalNotAllowed))
+		return
+	}
+
+	extraVars, err := s.getTokenVars(r.Context(), id)
 	if err != nil {
 		glog.Errorf("Get token extra vars error: %v", err)
-		http.Error(w, "Get user profile error", http.StatusInternalServerError)
+		if isAccessDenied(err) {
+			s.rejectConsent(w, r, request, denialReason(err))
+			return
+		}
+
+		if wework.IsAuthError(err) {
+			glog.Errorf("Wework credentials rejected. Check corp id, agent id and secret")
+		}
+
+		http.Error(w, "Get user profile error", weworkErrorStatus(err))
+		return
+	}
+
+	if group := s.cfg.ClientGroups[request.ClientId]; group != "" && !hasGroup(extraVars, group) {
+		s.denyGroup(w, r, request, id, group)
 		return
 	}
 
 	response, err = s.hcli.AcceptOAuth2ConsentRequest(
 		reqID,
 		swagger.ConsentRequestAcceptance{
-			Subject:          subjectOf(uid),
+			Subject:          id.subject(),
 			GrantScopes:      getScopes(request.RequestedScopes),
 			AccessTokenExtra: extraVars,
 			IdTokenExtra:     extraVars,
@@ -129,11 +326,51 @@ func (s *Server) ConsentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.wcli != nil && id.CorpID == "" && !id.external() {
+		s.notifyLogin(r, id.UserID, request.ClientId)
+	}
+
 	http.Redirect(w, r, request.RedirectUrl, http.StatusFound)
 }
 
-func subjectOf(uid string) string {
-	return "user:" + uid
+func (s *Server) rejectConsent(w http.ResponseWriter, r *http.Request, request *swagger.OAuth2ConsentRequest, reason string) {
+	glog.Infof("Rejecting consent request %v: %v", request.Id, reason)
+
+	response, err := s.hcli.RejectOAuth2ConsentRequest(
+		request.Id,
+		swagger.ConsentRequestRejection{
+			Reason: reason,
+		})
+
+	if err != nil {
+		glog.Errorf("Reject consent request failed. %v", err)
+		http.Error(w, "Reject consent request error", http.StatusInternalServerError)
+		return
+	}
+
+	if response.StatusCode != http.StatusNoContent {
+		glog.Errorf("Reject consent request unexpected http status: %v", response.Status)
+		http.Error(w, "Reject consent request error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, request.RedirectUrl, http.StatusFound)
+}
+
+// subjectOf returns the hydra subject of a user. Users signed in through a
+// service provider are qualified with their corp id.
+func subjectOf(corpID, uid string) string {
+	if corpID == "" {
+		return "user:" + uid
+	}
+
+	return "user:" + corpID + ":" + uid
+}
+
+// externalSubjectOf returns the hydra subject of a non-member, kept apart
+// from members so they never share groups.
+func externalSubjectOf(openID string) string {
+	return "external:" + openID
 }
 
 func consentID(r *http.Request) string {
@@ -164,48 +401,226 @@ func getAuthURL(consentID string) string {
 	return fmt.Sprintf("%s?consent=%s", pathAuth, consentID)
 }
 
-func (s *Server) getTokenVars(uid string) (map[string]interface{}, error) {
+func (s *Server) getTokenVars(ctx context.Context, id *identity) (map[string]interface{}, error) {
 	vars := make(map[string]interface{})
 
-	if err := s.collectUserInfo(uid, vars); err != nil {
-		return nil, err
+	if id.external() {
+		collectExternal(id, vars)
+	} else if wcli := s.userClient(id.CorpID); wcli != nil {
+		u, err := s.getActiveUser(ctx, wcli, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.checkVisible(ctx, id, u); err != nil {
+			return nil, err
+		}
+
+		collectProfile(u, vars)
+	} else {
+		collectLogin(id, vars)
+	}
+
+	if id.CorpID != "" {
+		vars["corpid"] = id.CorpID
 	}
 
-	if err := s.collectUserGroups(uid, vars); err != nil {
+	if id.Detail != nil {
+		collectDetail(id.Detail, vars)
+	}
+
+	if err := s.collectUserGroups(id.subject(), vars); err != nil {
 		return nil, err
 	}
 
-	glog.Infof("User authenticated. %v", vars)
+	glog.Infof("User %v authenticated.", id.subject())
 	return vars, nil
 }
 
-func (s *Server) collectUserInfo(uid string, vars map[string]interface{}) error {
-	userResp, err := s.wcli.GetUser(uid)
-	if err != nil {
-		return fmt.Errorf("Get wework user failed. %v", err)
+// userClient returns the client reading the directory of corpID, or nil if
+// the corp did not authorize the provider with a known permanent code.
+func (s *Server) userClient(corpID string) *wework.Client {
+	if corpID == "" {
+		return s.wcli
 	}
 
-	if userResp.Status != wework.UserActive {
-		return errors.New("User is not active")
+	code, ok := s.cfg.WeworkPermanentCodes[corpID]
+	if !ok {
+		return nil
 	}
 
-	vars["username"] = userResp.UserID
-	vars["name"] = userResp.EnglishName
-	vars["email"] = userResp.Email
-	vars["email_verified"] = true
+	return s.pcli.CorpClient(corpID, code)
+}
 
-	return nil
+// getActiveUser returns the profile of the member signed in, read from the
+// directory replica if it is fresh enough.
+func (s *Server) getActiveUser(ctx context.Context, wcli *wework.Client, id *identity) (*wework.User, error) {
+	u := s.replicaUser(id)
+	if u == nil {
+		userResp, err := wcli.GetUserContext(ctx, id.UserID)
+		if wework.ErrorCode(err) == wework.ErrCodeNoPrivilege {
+			// Members outside the visible range of the app are not
+			// reported as missing, but as beyond its privilege.
+			return nil, errUserNotVisible
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		u = &userResp.User
+	}
+
+	if u.Status != wework.UserActive {
+		return nil, errUserInactive
+	}
+
+	return u, nil
+}
+
+// replicaUser returns the member from the replica, or nil if it is stale or
+// does not know the member yet.
+func (s *Server) replicaUser(id *identity) *wework.User {
+	snapshot := s.freshSnapshot(id)
+	if snapshot == nil {
+		return nil
+	}
+
+	return snapshot.User(id.UserID)
 }
 
-func (s *Server) collectUserGroups(uid string, vars map[string]interface{}) error {
-	gs, _, err := s.hcli.ListGroups(subjectOf(uid), 100, 0)
+// freshSnapshot returns the snapshot of the directory replica if it is
+// recent enough to be read for id, or nil.
+func (s *Server) freshSnapshot(id *identity) *wework.Snapshot {
+	if s.replica == nil || id.CorpID != "" {
+		return nil
+	}
+
+	return s.replica.Fresh(s.cfg.DirectoryMaxStaleness)
+}
+
+// checkVisible denies users outside the visible range of the app, which
+// admins configure in the wework console. The range is evaluated against
+// the directory replica while it is fresh, and the cached range otherwise.
+func (s *Server) checkVisible(ctx context.Context, id *identity, u *wework.User) error {
+	if s.visibility == nil || id.CorpID != "" {
+		return nil
+	}
+
+	vr, err := s.visibleRange(ctx, id)
 	if err != nil {
-		return fmt.Errorf("Get hydra warden groups failed. %v", err)
+		return err
 	}
 
-	var groups []string
-	for _, g := range gs {
-		groups = append(groups, g.Id)
+	if !vr.Contains(u.UserID, u.Department) {
+		return errUserNotVisible
+	}
+
+	return nil
+}
+
+func (s *Server) visibleRange(ctx context.Context, id *identity) (*wework.VisibleRange, error) {
+	if snapshot := s.freshSnapshot(id); snapshot != nil && snapshot.VisibleRange() != nil {
+		return snapshot.VisibleRange(), nil
+	}
+
+	return s.visibility.Range(ctx)
+}
+
+// invalidateVisibility reloads the visible range after contact changes,
+// which may move users in or out of it.
+func (s *Server) invalidateVisibility(ctx context.Context, ev *wework.Event) {
+	if ev.IsContactChange() {
+		s.visibility.Invalidate()
+	}
+}
+
+func collectProfile(u *wework.User, vars map[string]interface{}) {
+	vars["username"] = u.UserID
+	vars["name"] = u.DisplayName()
+
+	setClaim(vars, "nickname", u.Alias)
+	setClaim(vars, "position", u.Position)
+	setClaim(vars, "picture", u.Avatar)
+
+	collectContact(vars, firstOf(u.Email, u.BizMail), u.Mobile, u.Gender)
+
+	if len(u.Department) > 0 {
+		vars["departments"] = u.Department
+		vars["main_department"] = u.PrimaryDepartment()
+	}
+
+	if len(u.DirectLeader) > 0 {
+		vars["direct_leader"] = u.DirectLeader
+	}
+}
+
+// collectExternal emits the limited claims of a non-member.
+func collectExternal(id *identity, vars map[string]interface{}) {
+	vars["external"] = true
+	vars["openid"] = id.OpenID
+	setClaim(vars, "external_userid", id.ExternalID)
+}
+
+// collectLogin emits the few claims known from a service provider login when
+// the directory of the corp cannot be read.
+func collectLogin(id *identity, vars map[string]interface{}) {
+	vars["username"] = id.UserID
+	vars["name"] = id.UserID
+
+	if id.Login != nil {
+		setClaim(vars, "name", id.Login.Name)
+		setClaim(vars, "picture", id.Login.Avatar)
+	}
+}
+
+// collectDetail overrides profile claims with the sensitive profile, which
+// user/get no longer returns for newer apps.
+func collectDetail(d *wework.UserDetail, vars map[string]interface{}) {
+	setClaim(vars, "picture", d.Avatar)
+
+	collectContact(vars, firstOf(d.Email, d.BizMail), d.Mobile, d.Gender)
+}
+
+func collectContact(vars map[string]interface{}, email, mobile string, gender wework.Gender) {
+	if email != "" {
+		vars["email"] = email
+		vars["email_verified"] = true
+	}
+
+	if mobile != "" {
+		vars["phone_number"] = mobile
+		vars["phone_number_verified"] = true
+	}
+
+	switch gender {
+	case wework.GenderMale:
+		vars["gender"] = "male"
+	case wework.GenderFemale:
+		vars["gender"] = "female"
+	}
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+func setClaim(vars map[string]interface{}, name, value string) {
+	if value != "" {
+		vars[name] = value
+	}
+}
+
+func (s *Server) collectUserGroups(subject string, vars map[string]interface{}) error {
+	groups, err := s.groupsOf(subject)
+	if err != nil {
+		return fmt.Errorf("Get hydra warden groups failed. %v", err)
 	}
 
 	vars["groups"] = groups
@@ -213,18 +628,45 @@ func (s *Server) collectUserGroups(uid string, vars map[string]interface{}) erro
 	return nil
 }
 
+// groupsOf returns the ids of the warden groups subject is a member of.
+func (s *Server) groupsOf(subject string) ([]string, error) {
+	var groups []string
+	for offset := int64(0); ; offset += groupsPageSize {
+		gs, response, err := s.hcli.ListGroups(subject, groupsPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("list groups unexpected http status: %v", response.Status)
+		}
+
+		for _, g := range gs {
+			groups = append(groups, g.Id)
+		}
+
+		if len(gs) < groupsPageSize {
+			return groups, nil
+		}
+	}
+}
+
+// hasGroup reports whether the groups collected into vars include group.
+func hasGroup(vars map[string]interface{}, group string) bool {
+	groups, _ := vars["groups"].([]string)
+	return contains(groups, group)
+}
+
 func (s *Server) AuthHandler(w http.ResponseWriter, r *http.Request) {
 	state := r.URL.Query().Get("consent")
 	callbackURL := getWeworkCallbackURL(s.cfg.HTTPS, r.Host)
 
-	var u string
-	if isInWework(r) {
-		u = s.wcli.GetOAuthURL(callbackURL, state)
-	} else {
-		u = s.wcli.GetQRConnectURL(callbackURL, state)
+	if s.useLoginPage(r) {
+		s.renderLogin(w, r, callbackURL, state)
+		return
 	}
 
-	http.Redirect(w, r, u, http.StatusFound)
+	http.Redirect(w, r, s.auth.AuthURL(r, callbackURL, state), http.StatusFound)
 }
 
 func isInWework(r *http.Request) bool {
@@ -232,27 +674,34 @@ func isInWework(r *http.Request) bool {
 }
 
 func getWeworkCallbackURL(https bool, host string) string {
+	return externalURL(https, host, pathCallback)
+}
+
+func externalURL(https bool, host, path string) string {
 	scheme := "https"
 	if !https {
 		scheme = "http"
 	}
 
-	return fmt.Sprintf("%s://%s%s", scheme, host, pathCallback)
+	return fmt.Sprintf("%s://%s%s", scheme, host, path)
 }
 
 func (s *Server) CallbackHandler(w http.ResponseWriter, r *http.Request) {
-	code := r.URL.Query().Get("code")
-	uid, err := s.wcli.GetUserInfo(code)
+	id, err := s.auth.Authenticate(r.Context(), r)
 	if err != nil {
 		glog.Errorf("Get user info failed. %v", err)
-		http.Error(w, "Get user info failed", http.StatusInternalServerError)
+		http.Error(w, "Get user info failed", weworkErrorStatus(err))
 		return
 	}
 
-	glog.Infof("User signed in as wework user %v", uid)
+	glog.Infof("User signed in as wework user %v", id.subject())
 	session := s.session(r)
-	session.Values["uid"] = uid
-	session.Save(r, w)
+	s.saveIdentity(r.Context(), session, id)
+	if err := session.Save(r, w); err != nil {
+		glog.Errorf("Save session failed. %v", err)
+		http.Error(w, "Save session failed", http.StatusInternalServerError)
+		return
+	}
 
 	consentURL := getConsentURL(r.URL.Query().Get("state"))
 	http.Redirect(w, r, consentURL, http.StatusFound)
@@ -262,6 +711,29 @@ func getConsentURL(consentID string) string {
 	return fmt.Sprintf("%s?consent=%s", pathConsent, consentID)
 }
 
+// hydraScopes returns the scopes the adapter requests from hydra, only
+// asking for those the enabled features need.
+func hydraScopes(c *Config) []string {
+	scopes := []string{"hydra.consent", "hydra.warden.groups"}
+	if c.LoginPage || c.AccessRequests {
+		scopes = append(scopes, "hydra.clients")
+	}
+
+	if c.PeopleAPI {
+		scopes = append(scopes, "hydra.introspect")
+	}
+
+	return scopes
+}
+
+// cookieKeys returns the keys authenticating and encrypting the session
+// cookie, which holds the sensitive profile. The encryption key is derived
+// from secret as well.
+func cookieKeys(secret string) ([]byte, []byte) {
+	blockKey := sha256.Sum256([]byte("encryption:" + secret))
+	return []byte(secret), blockKey[:]
+}
+
 func (s *Server) session(r *http.Request) *sessions.Session {
 	session, _ := s.store.Get(r, "identity_session")
 	return session
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/pragkent/hydra-wework/wework"
+	"github.com/pragkent/hydra-wework/wework/weworktest"
+)
+
+func TestHydraScopes(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want []string
+	}{
+		{
+			name: "default",
+			want: []string{"hydra.consent", "hydra.warden.groups"},
+		},
+		{
+			name: "login page",
+			cfg:  Config{LoginPage: true},
+			want: []string{"hydra.consent", "hydra.warden.groups", "hydra.clients"},
+		},
+		{
+			name: "access requests",
+			cfg:  Config{AccessRequests: true},
+			want: []string{"hydra.consent", "hydra.warden.groups", "hydra.clients"},
+		},
+		{
+			name: "people api",
+			cfg:  Config{PeopleAPI: true},
+			want: []string{"hydra.consent", "hydra.warden.groups", "hydra.introspect"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hydraScopes(&tt.cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("hydraScopes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetActiveUser(t *testing.T) {
+	ws := weworktest.NewServer()
+	defer ws.Close()
+
+	ws.AddUser(wework.User{UserID: "zhangsan", Name: "张三"})
+	ws.AddUser(wework.User{UserID: "lisi", Name: "李四", Status: wework.UserDisabled})
+
+	wcli := ws.Client()
+	defer wcli.Close()
+
+	tests := []struct {
+		name   string
+		uid    string
+		fault  int
+		want   string
+		denied bool
+		err    error
+	}{
+		{name: "active", uid: "zhangsan", want: "zhangsan"},
+		{name: "disabled", uid: "lisi", denied: true, err: errUserInactive},
+		{name: "left", uid: "wangwu", denied: true},
+		{name: "outside visible range", uid: "zhangsan", fault: wework.ErrCodeNoPrivilege, denied: true, err: errUserNotVisible},
+	}
+
+	s := &Server{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.fault != 0 {
+				ws.FailNext("/cgi-bin/user/get", tt.fault, 1)
+				defer ws.ClearFaults()
+			}
+
+			u, err := s.getActiveUser(context.Background(), wcli, &identity{UserID: tt.uid})
+			if tt.denied {
+				if !isAccessDenied(err) || (tt.err != nil && err != tt.err) {
+					t.Errorf("getActiveUser error = %v, want access denied", err)
+				}
+				return
+			}
+
+			if err != nil || u.UserID != tt.want {
+				t.Errorf("getActiveUser = %+v, %v, want %v", u, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/subtle"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+	"github.com/pragkent/hydra-wework/wework"
+)
+
+const (
+	pathVerify         = "/wework/verify"
+	pathVerifyRequests = "/wework/verify/requests"
+
+	// verifyStateKey is the session value holding the oauth state of the
+	// verification in progress, so that codes are only accepted from the
+	// round trip the browser started.
+	verifyStateKey = "verify_state"
+)
+
+var messageTemplate = template.Must(template.New("message").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; text-align: center; margin-top: 48px; color: #333; }
+</style>
+</head>
+<body>
+<h2>{{.Title}}</h2>
+<p>{{.Text}}</p>
+</body>
+</html>
+`))
+
+type messagePage struct {
+	Title string
+	Text  string
+}
+
+func renderMessage(w http.ResponseWriter, status int, title, text string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+
+	if err := messageTemplate.Execute(w, &messagePage{Title: title, Text: text}); err != nil {
+		glog.Errorf("Render message page failed. %v", err)
+	}
+}
+
+// VerifyHandler hosts the secondary verification page wework sends new
+// members to. Members passing the join policy are let in with authsucc,
+// right away or once an admin approves.
+func (s *Server) VerifyHandler(w http.ResponseWriter, r *http.Request) {
+	session := s.session(r)
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		state := newRandomID()
+		session.Values[verifyStateKey] = state
+		if err := session.Save(r, w); err != nil {
+			glog.Errorf("Save session failed. %v", err)
+			http.Error(w, "Save session failed", http.StatusInternalServerError)
+			return
+		}
+
+		verifyURL := externalURL(s.cfg.HTTPS, r.Host, pathVerify)
+		http.Redirect(w, r, s.wcli.GetOAuthURL(verifyURL, state), http.StatusFound)
+		return
+	}
+
+	state, _ := session.Values[verifyStateKey].(string)
+	if state == "" || !hmac.Equal([]byte(state), []byte(r.URL.Query().Get("state"))) {
+		renderMessage(w, http.StatusBadRequest, "Verification expired", "Open the verification link from WeCom again.")
+		return
+	}
+
+	delete(session.Values, verifyStateKey)
+	if err := session.Save(r, w); err != nil {
+		glog.Errorf("Save session failed. %v", err)
+	}
+
+	info, err := s.wcli.AuthenticateContext(r.Context(), code)
+	if err != nil {
+		glog.Errorf("Get user info failed. %v", err)
+		http.Error(w, "Get user info failed", weworkErrorStatus(err))
+		return
+	}
+
+	userResp, err := s.wcli.GetUserContext(r.Context(), info.UserID)
+	if err != nil {
+		glog.Errorf("Get user %v failed. %v", info.UserID, err)
+		http.Error(w, "Get user profile error", weworkErrorStatus(err))
+		return
+	}
+
+	u := &userResp.User
+	if err := s.checkJoinPolicy(r.Context(), u); err != nil {
+		if !isAccessDenied(err) {
+			glog.Errorf("Check join policy of %v failed. %v", u.UserID, err)
+			http.Error(w, "Check join policy error", weworkErrorStatus(err))
+			return
+		}
+
+		glog.Infof("Wework user %v denied joining: %v", u.UserID, denialReason(err))
+		renderMessage(w, http.StatusForbidden, "Verification failed", "You cannot join: "+denialReason(err)+".")
+		return
+	}
+
+	if s.cfg.VerifyApproval {
+		err := s.joins.Add(&JoinRequest{
+			UserID:      u.UserID,
+			Name:        u.Name,
+			Email:       firstOf(u.Email, u.BizMail),
+			Mobile:      u.Mobile,
+			Departments: u.Department,
+			RequestedAt: time.Now(),
+		})
+
+		if err != nil {
+			glog.Errorf("Save join request of %v failed. %v", u.UserID, err)
+			http.Error(w, "Save join request error", http.StatusInternalServerError)
+			return
+		}
+
+		glog.Infof("Wework user %v awaiting join approval", u.UserID)
+		renderMessage(w, http.StatusOK, "Awaiting approval", "An administrator will review your request to join.")
+		return
+	}
+
+	if err := s.wcli.AuthSuccContext(r.Context(), u.UserID); err != nil {
+		glog.Errorf("Verify user %v failed. %v", u.UserID, err)
+		http.Error(w, "Verify user error", weworkErrorStatus(err))
+		return
+	}
+
+	glog.Infof("Wework user %v verified", u.UserID)
+	renderMessage(w, http.StatusOK, "Verified", "You can now use WeCom.")
+}
+
+// checkJoinPolicy denies new members outside the allowed email domains or
+// departments.
+func (s *Server) checkJoinPolicy(ctx context.Context, u *wework.User) error {
+	if len(s.cfg.VerifyEmailDomains) > 0 && !hasEmailDomain(s.cfg.VerifyEmailDomains, u.Email, u.BizMail) {
+		return errEmailDomain
+	}
+
+	if len(s.cfg.VerifyDepartments) == 0 {
+		return nil
+	}
+
+	tree, err := s.wcli.GetDepartmentTreeContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range u.Department {
+		ids := []int{d}
+		if n := tree.Get(d); n != nil {
+			ids = append(ids, n.Ancestors()...)
+		}
+
+		for _, id := range ids {
+			if containsInt(s.cfg.VerifyDepartments, id) {
+				return nil
+			}
+		}
+	}
+
+	return errDepartment
+}
+
+func hasEmailDomain(domains []string, emails ...string) bool {
+	for _, e := range emails {
+		i := strings.LastIndex(e, "@")
+		if i < 0 {
+			continue
+		}
+
+		for _, d := range domains {
+			if strings.EqualFold(e[i+1:], d) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func containsInt(values []int, n int) bool {
+	for _, i := range values {
+		if i == n {
+			return true
+		}
+	}
+
+	return false
+}
+
+// JoinRequestsHandler lists the join requests pending approval.
+func (s *Server) JoinRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	reqs, err := s.joins.List()
+	if err != nil {
+		glog.Errorf("List join requests failed. %v", err)
+		http.Error(w, "List join requests error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(reqs)
+}
+
+// JoinDecisionHandler approves or rejects a pending join request.
+func (s *Server) JoinDecisionHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	uid := vars["uid"]
+
+	req, err := s.joins.Remove(uid)
+	if err != nil {
+		glog.Errorf("Remove join request of %v failed. %v", uid, err)
+		http.Error(w, "Remove join request error", http.StatusInternalServerError)
+		return
+	}
+
+	if req == nil {
+		http.Error(w, "Join request not found", http.StatusNotFound)
+		return
+	}
+
+	if vars["action"] == "reject" {
+		glog.Infof("Join of wework user %v rejected", uid)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err := s.wcli.AuthSuccContext(r.Context(), uid); err != nil {
+		glog.Errorf("Verify user %v failed. %v", uid, err)
+		if err := s.joins.Add(req); err != nil {
+			glog.Errorf("Requeue join request of %v failed. %v", uid, err)
+		}
+
+		http.Error(w, "Verify user error", weworkErrorStatus(err))
+		return
+	}
+
+	glog.Infof("Join of wework user %v approved", uid)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isAdmin reports whether r carries the admin bearer token.
+func (s *Server) isAdmin(r *http.Request) bool {
+	token := bearerToken(r)
+	if s.cfg.AdminToken == "" || token == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminToken)) == 1
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/pragkent/hydra-wework/wework"
+	"github.com/pragkent/hydra-wework/wework/weworktest"
+)
+
+func newVerifyServer(t *testing.T, ws *weworktest.Server, approval bool) *Server {
+	c := &Config{
+		CookieSecret:      "secret",
+		HydraURL:          "http://127.0.0.1:1",
+		HydraClientID:     "hydra-wework",
+		HydraClientSecret: "secret",
+		WeworkCorpID:      ws.CorpID,
+		WeworkAgentID:     ws.AgentID,
+		WeworkSecret:      ws.Secret,
+		WeworkAPIURL:      ws.URL,
+		WeworkOAuthScope:  wework.ScopeBase,
+		WeworkTokenRatio:  wework.DefaultTokenRefreshRatio,
+		LoginLang:         "zh",
+		SecondaryVerify:   true,
+		AdminToken:        "admin",
+	}
+
+	if approval {
+		dir, err := ioutil.TempDir("", "joins")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.VerifyApproval = true
+		c.VerifyRequestDir = dir
+	}
+
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate error: %v", err)
+	}
+
+	s, err := New(c)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	return s
+}
+
+func TestJoinRequestRoutes(t *testing.T) {
+	ws := weworktest.NewServer()
+	defer ws.Close()
+
+	tests := []struct {
+		name     string
+		approval bool
+		method   string
+		path     string
+		want     int
+	}{
+		{"list without approval", false, http.MethodGet, pathVerifyRequests, http.StatusNotFound},
+		{"decide without approval", false, http.MethodPost, pathVerifyRequests + "/zhangsan/approve", http.StatusNotFound},
+		{"list with approval", true, http.MethodGet, pathVerifyRequests, http.StatusOK},
+		{"decide with approval", true, http.MethodPost, pathVerifyRequests + "/zhangsan/approve", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newVerifyServer(t, ws, tt.approval)
+			defer s.Close()
+			defer os.RemoveAll(s.cfg.VerifyRequestDir)
+
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("Authorization", "Bearer admin")
+
+			w := httptest.NewRecorder()
+			s.mux.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %v, want %v", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyHandlerState(t *testing.T) {
+	ws := weworktest.NewServer()
+	defer ws.Close()
+
+	ws.AddUser(wework.User{UserID: "zhangsan", Name: "张三", Department: []int{wework.RootDepartmentID}})
+
+	s := newVerifyServer(t, ws, true)
+	defer s.Close()
+	defer os.RemoveAll(s.cfg.VerifyRequestDir)
+
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, pathVerify, nil))
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %v, want %v", w.Code, http.StatusFound)
+	}
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := location.Query().Get("state")
+	if state == "" {
+		t.Fatalf("redirect %v has no state", location)
+	}
+
+	cookies := w.Result().Cookies()
+
+	tests := []struct {
+		name    string
+		state   string
+		cookies bool
+		want    int
+	}{
+		{"no session", state, false, http.StatusBadRequest},
+		{"forged state", "forged", true, http.StatusBadRequest},
+		{"matching state", state, true, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := url.Values{"code": {ws.Code("zhangsan")}, "state": {tt.state}}
+			r := httptest.NewRequest(http.MethodGet, pathVerify+"?"+q.Encode(), nil)
+			if tt.cookies {
+				for _, c := range cookies {
+					r.AddCookie(c)
+				}
+			}
+
+			w := httptest.NewRecorder()
+			s.mux.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %v, want %v", w.Code, tt.want)
+			}
+		})
+	}
+
+	reqs, err := s.joins.List()
+	if err != nil || len(reqs) != 1 || reqs[0].UserID != "zhangsan" {
+		t.Errorf("join requests = %+v, %v, want the one of zhangsan", reqs, err)
+	}
+}
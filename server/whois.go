@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/pragkent/hydra-wework/wework"
+)
+
+// WhoisResult is what a user would be issued on sign-in.
+type WhoisResult struct {
+	UserID  string                 `json:"userid"`
+	Subject string                 `json:"subject"`
+	Allowed bool                   `json:"allowed"`
+	Reason  string                 `json:"reason,omitempty"`
+	Claims  map[string]interface{} `json:"claims,omitempty"`
+}
+
+// Whois resolves query, a user id, email address or mobile number, to a
+// member and returns the claims its sign-in would be issued, or why it
+// would be denied.
+func (s *Server) Whois(ctx context.Context, query string) (*WhoisResult, error) {
+	if s.wcli == nil {
+		return nil, errors.New("whois is not supported in provider mode")
+	}
+
+	uid, err := s.resolveUserID(ctx, query)
+	if err != nil && !wework.IsNotFound(err) {
+		return nil, err
+	}
+
+	if uid == "" {
+		return &WhoisResult{Reason: denialReason(err)}, nil
+	}
+
+	id := &identity{UserID: uid}
+	result := &WhoisResult{
+		UserID:  uid,
+		Subject: id.subject(),
+	}
+
+	vars, err := s.getTokenVars(ctx, id)
+	if err != nil {
+		if !isAccessDenied(err) {
+			return nil, err
+		}
+
+		result.Reason = denialReason(err)
+		return result, nil
+	}
+
+	result.Allowed = true
+	result.Claims = vars
+	return result, nil
+}
+
+func (s *Server) resolveUserID(ctx context.Context, query string) (string, error) {
+	switch {
+	case strings.Contains(query, "@"):
+		uid, err := s.wcli.GetUserIDByEmailContext(ctx, query, wework.EmailTypeBiz)
+		if !wework.IsNotFound(err) {
+			return uid, err
+		}
+
+		return s.wcli.GetUserIDByEmailContext(ctx, query, wework.EmailTypePersonal)
+	case isMobile(query):
+		uid, err := s.wcli.GetUserIDByMobileContext(ctx, query)
+		if !wework.IsNotFound(err) {
+			return uid, err
+		}
+
+		// User ids may be numeric too.
+		return query, nil
+	default:
+		return query, nil
+	}
+}
+
+func isMobile(s string) bool {
+	s = strings.TrimPrefix(s, "+")
+	if len(s) < 7 {
+		return false
+	}
+
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
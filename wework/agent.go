@@ -0,0 +1,161 @@
+package wework
+
+import (
+	"context"
+	"net/url"
+)
+
+const (
+	getAgentPath = "/cgi-bin/agent/get"
+)
+
+type Agent struct {
+	AgentID            int              `json:"agentid"`
+	Name               string           `json:"name,omitempty"`
+	SquareLogoURL      string           `json:"square_logo_url,omitempty"`
+	Description        string           `json:"description,omitempty"`
+	AllowUsers         AgentAllowUsers  `json:"allow_userinfos"`
+	AllowDepartments   AgentAllowPartys `json:"allow_partys"`
+	AllowTags          AgentAllowTags   `json:"allow_tags"`
+	Close              int              `json:"close,omitempty"`
+	RedirectDomain     string           `json:"redirect_domain,omitempty"`
+	ReportLocationFlag int              `json:"report_location_flag,omitempty"`
+	IsReportEnter      int              `json:"isreportenter,omitempty"`
+	HomeURL            string           `json:"home_url,omitempty"`
+}
+
+type AgentAllowUsers struct {
+	Users []AgentUser `json:"user,omitempty"`
+}
+
+type AgentUser struct {
+	UserID string `json:"userid"`
+}
+
+type AgentAllowPartys struct {
+	IDs []int `json:"partyid,omitempty"`
+}
+
+type AgentAllowTags struct {
+	IDs []int `json:"tagid,omitempty"`
+}
+
+type GetAgentResponse struct {
+	Code    int    `json:"errcode,omitempty"`
+	Message string `json:"errmsg,omitempty"`
+	Agent
+}
+
+func (c *Client) GetAgent(agentID string) (*GetAgentResponse, error) {
+	return c.GetAgentContext(context.Background(), agentID)
+}
+
+func (c *Client) GetAgentContext(ctx context.Context, agentID string) (*GetAgentResponse, error) {
+	q := url.Values{}
+	q.Set("agentid", agentID)
+
+	u := getAgentPath + "?" + q.Encode()
+
+	var resp GetAgentResponse
+	if err := c.getJSON(ctx, CredentialApp, u, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// VisibleRange answers whether a user is within the visible range of an
+// agent, i.e. listed directly, in a listed department or one of its
+// descendants, or tagged with a listed tag.
+type VisibleRange struct {
+	users map[string]bool
+	depts map[int]bool
+	tags  map[int]bool
+	index *TagIndex
+}
+
+// NewVisibleRange builds the range of agent. index resolves tags and parent
+// departments, and may be nil if the agent lists users only.
+func NewVisibleRange(agent *Agent, index *TagIndex) *VisibleRange {
+	vr := &VisibleRange{
+		users: make(map[string]bool),
+		depts: make(map[int]bool),
+		tags:  make(map[int]bool),
+		index: index,
+	}
+
+	for _, u := range agent.AllowUsers.Users {
+		vr.users[u.UserID] = true
+	}
+
+	for _, id := range agent.AllowDepartments.IDs {
+		vr.depts[id] = true
+	}
+
+	for _, id := range agent.AllowTags.IDs {
+		vr.tags[id] = true
+	}
+
+	return vr
+}
+
+// Contains reports whether uid, a member of deptIDs, may use the agent.
+func (vr *VisibleRange) Contains(uid string, deptIDs []int) bool {
+	if vr.users[uid] {
+		return true
+	}
+
+	for _, d := range deptIDs {
+		if vr.depts[d] {
+			return true
+		}
+
+		if vr.index == nil || vr.index.deptTree == nil {
+			continue
+		}
+
+		if n := vr.index.deptTree.Get(d); n != nil {
+			for _, a := range n.Ancestors() {
+				if vr.depts[a] {
+					return true
+				}
+			}
+		}
+	}
+
+	if len(vr.tags) == 0 || vr.index == nil {
+		return false
+	}
+
+	for _, t := range vr.index.TagsForUser(uid, deptIDs) {
+		if vr.tags[t.ID] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetVisibleRange fetches the agent and, unless it lists users only, the tag
+// index needed to resolve its range.
+func (c *Client) GetVisibleRange(agentID string) (*VisibleRange, error) {
+	return c.GetVisibleRangeContext(context.Background(), agentID)
+}
+
+func (c *Client) GetVisibleRangeContext(ctx context.Context, agentID string) (*VisibleRange, error) {
+	agent, err := c.GetAgentContext(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(agent.AllowDepartments.IDs) == 0 && len(agent.AllowTags.IDs) == 0 {
+		return NewVisibleRange(&agent.Agent, nil), nil
+	}
+
+	index, err := c.GetTagIndexContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewVisibleRange(&agent.Agent, index), nil
+}
@@ -0,0 +1,75 @@
+package wework
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	DefaultVisibleRangeTTL = 5 * time.Minute
+)
+
+// VisibleRangeCache keeps the VisibleRange of an agent for ttl so consent
+// checks do not hit the api. The tags the range is resolved with are kept
+// in a TagCache of the same ttl.
+type VisibleRangeCache struct {
+	tags *TagCache
+	vr   *cachedValue
+}
+
+func NewVisibleRangeCache(c *Client, agentID string, ttl time.Duration) *VisibleRangeCache {
+	if ttl <= 0 {
+		ttl = DefaultVisibleRangeTTL
+	}
+
+	vc := &VisibleRangeCache{
+		tags: NewTagCache(c, ttl),
+	}
+
+	vc.vr = newCachedValue(ttl, func(ctx context.Context) (interface{}, error) {
+		agent, err := c.GetAgentContext(ctx, agentID)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(agent.AllowDepartments.IDs) == 0 && len(agent.AllowTags.IDs) == 0 {
+			return NewVisibleRange(&agent.Agent, nil), nil
+		}
+
+		index, err := vc.tags.Index(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewVisibleRange(&agent.Agent, index), nil
+	})
+
+	return vc
+}
+
+// Range returns the cached range, reloading it if it is older than ttl.
+func (vc *VisibleRangeCache) Range(ctx context.Context) (*VisibleRange, error) {
+	v, err := vc.vr.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*VisibleRange), nil
+}
+
+// Contains reports whether uid, a member of deptIDs, may use the agent.
+func (vc *VisibleRangeCache) Contains(ctx context.Context, uid string, deptIDs []int) (bool, error) {
+	vr, err := vc.Range(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return vr.Contains(uid, deptIDs), nil
+}
+
+// Invalidate drops the cached range and tags so the next lookup reloads
+// them.
+func (vc *VisibleRangeCache) Invalidate() {
+	vc.tags.Invalidate()
+	vc.vr.invalidate()
+}
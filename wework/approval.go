@@ -0,0 +1,145 @@
+package wework
+
+import (
+	"context"
+)
+
+const (
+	applyEventPath        = "/cgi-bin/oa/applyevent"
+	getApprovalDetailPath = "/cgi-bin/oa/getapprovaldetail"
+)
+
+// ApprovalStatus is the state of an approval.
+type ApprovalStatus int
+
+const (
+	ApprovalPending              ApprovalStatus = 1
+	ApprovalApproved             ApprovalStatus = 2
+	ApprovalRejected             ApprovalStatus = 3
+	ApprovalRevoked              ApprovalStatus = 4
+	ApprovalRevokedAfterApproval ApprovalStatus = 6
+	ApprovalDeleted              ApprovalStatus = 7
+	ApprovalPaid                 ApprovalStatus = 10
+)
+
+// ApproverAttr tells whether one or all approvers of a step must approve.
+type ApproverAttr int
+
+const (
+	ApproverAny ApproverAttr = 1
+	ApproverAll ApproverAttr = 2
+)
+
+// ApplyEventRequest submits an approval on behalf of CreatorUserID with the
+// template TemplateID. Approvers route it unless UseTemplateApprover is set.
+type ApplyEventRequest struct {
+	CreatorUserID       string            `json:"creator_userid"`
+	TemplateID          string            `json:"template_id"`
+	UseTemplateApprover int               `json:"use_template_approver"`
+	Approvers           []Approver        `json:"approver,omitempty"`
+	Notifiers           []string          `json:"notifyer,omitempty"`
+	NotifyType          int               `json:"notify_type,omitempty"`
+	ApplyData           ApplyData         `json:"apply_data"`
+	SummaryList         []ApprovalSummary `json:"summary_list,omitempty"`
+}
+
+type Approver struct {
+	Attr    ApproverAttr `json:"attr"`
+	UserIDs []string     `json:"userid"`
+}
+
+// ApplyData holds the values of the template controls.
+type ApplyData struct {
+	Contents []ApplyContent `json:"contents"`
+}
+
+type ApplyContent struct {
+	Control string     `json:"control"`
+	ID      string     `json:"id"`
+	Value   ApplyValue `json:"value"`
+}
+
+type ApplyValue struct {
+	Text string `json:"text,omitempty"`
+}
+
+// ApprovalSummary is a line shown on the approval card, up to 3 in all.
+type ApprovalSummary struct {
+	SummaryInfo []ApprovalText `json:"summary_info"`
+}
+
+type ApprovalText struct {
+	Text string `json:"text"`
+	Lang string `json:"lang"`
+}
+
+// NewTextApplyContent returns the value of the text or textarea control id.
+func NewTextApplyContent(control, id, text string) ApplyContent {
+	return ApplyContent{Control: control, ID: id, Value: ApplyValue{Text: text}}
+}
+
+// NewApprovalSummary returns a summary line in Chinese.
+func NewApprovalSummary(text string) ApprovalSummary {
+	return ApprovalSummary{SummaryInfo: []ApprovalText{{Text: text, Lang: "zh_CN"}}}
+}
+
+type ApplyEventResponse struct {
+	Code    int    `json:"errcode,omitempty"`
+	Message string `json:"errmsg,omitempty"`
+	SpNo    string `json:"sp_no,omitempty"`
+}
+
+// ApplyEvent submits an approval and returns its number. It is not retried
+// on retryable errors, to avoid submitting the approval twice.
+func (c *Client) ApplyEvent(req *ApplyEventRequest) (*ApplyEventResponse, error) {
+	return c.ApplyEventContext(context.Background(), req)
+}
+
+func (c *Client) ApplyEventContext(ctx context.Context, req *ApplyEventRequest) (*ApplyEventResponse, error) {
+	var resp ApplyEventResponse
+	if err := c.postJSONOnce(ctx, CredentialApproval, applyEventPath, req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+type ApprovalDetail struct {
+	SpNo       string         `json:"sp_no"`
+	SpName     string         `json:"sp_name"`
+	SpStatus   ApprovalStatus `json:"sp_status"`
+	TemplateID string         `json:"template_id"`
+	ApplyTime  int64          `json:"apply_time"`
+	Applyer    ApprovalUser   `json:"applyer"`
+}
+
+type ApprovalUser struct {
+	UserID  string `json:"userid"`
+	PartyID string `json:"partyid,omitempty"`
+}
+
+type GetApprovalDetailResponse struct {
+	Code    int            `json:"errcode,omitempty"`
+	Message string         `json:"errmsg,omitempty"`
+	Info    ApprovalDetail `json:"info"`
+}
+
+type getApprovalDetailRequest struct {
+	SpNo string `json:"sp_no"`
+}
+
+// GetApprovalDetail returns the approval spNo.
+func (c *Client) GetApprovalDetail(spNo string) (*GetApprovalDetailResponse, error) {
+	return c.GetApprovalDetailContext(context.Background(), spNo)
+}
+
+func (c *Client) GetApprovalDetailContext(ctx context.Context, spNo string) (*GetApprovalDetailResponse, error) {
+	req := getApprovalDetailRequest{SpNo: spNo}
+
+	var resp GetApprovalDetailResponse
+	if err := c.postJSON(ctx, CredentialApproval, getApprovalDetailPath, &req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
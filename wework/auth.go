@@ -1,15 +1,27 @@
 package wework
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"net/url"
 )
 
 const (
-	oauthURL     = "https://open.weixin.qq.com/connect/oauth2/authorize"
-	qrConnectURL = "https://open.work.weixin.qq.com/wwopen/sso/qrConnect"
-	userInfoURL  = "https://qyapi.weixin.qq.com/cgi-bin/user/getuserinfo"
+	oauthURL       = "https://open.weixin.qq.com/connect/oauth2/authorize"
+	qrConnectURL   = "https://open.work.weixin.qq.com/wwopen/sso/qrConnect"
+	webLoginURL    = "https://login.work.weixin.qq.com/wwlogin/sso/login"
+	userInfoPath   = "/cgi-bin/user/getuserinfo"
+	userDetailPath = "/cgi-bin/auth/getuserdetail"
+
+	// ScopeBase only identifies the user.
+	ScopeBase = "snsapi_base"
+
+	// ScopePrivateInfo additionally asks the user to grant access to the
+	// sensitive profile, returned by GetUserDetail.
+	ScopePrivateInfo = "snsapi_privateinfo"
+
+	LoginTypeCorpApp    = "CorpApp"
+	LoginTypeServiceApp = "ServiceApp"
 )
 
 func (c *Client) GetQRConnectURL(redirectURI, state string) string {
@@ -22,12 +34,66 @@ func (c *Client) GetQRConnectURL(redirectURI, state string) string {
 	return fmt.Sprintf("%s?%s", qrConnectURL, q.Encode())
 }
 
+// WebLogin holds the parameters of the web login, either embedded with the
+// wwLogin panel of the wework js sdk or opened at URL.
+type WebLogin struct {
+	LoginType   string `json:"login_type"`
+	AppID       string `json:"appid"`
+	AgentID     string `json:"agentid,omitempty"`
+	RedirectURI string `json:"redirect_uri"`
+	State       string `json:"state"`
+
+	// RedirectType is how the panel returns the code, "top" to navigate
+	// the top window to RedirectURI.
+	RedirectType string `json:"redirect_type,omitempty"`
+
+	// Lang is the language of the panel, "zh" or "en".
+	Lang string `json:"lang,omitempty"`
+
+	// Href is the url of a custom stylesheet for the panel. It must be
+	// https.
+	Href string `json:"href,omitempty"`
+}
+
+// GetWebLogin returns the web login parameters of the app. Lang and Href
+// may be set on the result.
+func (c *Client) GetWebLogin(redirectURI, state string) *WebLogin {
+	return &WebLogin{
+		LoginType:    LoginTypeCorpApp,
+		AppID:        c.corpID,
+		AgentID:      c.agentID,
+		RedirectURI:  redirectURI,
+		State:        state,
+		RedirectType: "top",
+	}
+}
+
+// URL returns the url of the full page web login.
+func (l *WebLogin) URL() string {
+	q := url.Values{}
+	q.Set("login_type", l.LoginType)
+	q.Set("appid", l.AppID)
+	if l.AgentID != "" {
+		q.Set("agentid", l.AgentID)
+	}
+	q.Set("redirect_uri", l.RedirectURI)
+	q.Set("state", l.State)
+	if l.Lang != "" {
+		q.Set("lang", l.Lang)
+	}
+	if l.Href != "" {
+		q.Set("href", l.Href)
+	}
+
+	return fmt.Sprintf("%s?%s", webLoginURL, q.Encode())
+}
+
 func (c *Client) GetOAuthURL(redirectURI, state string) string {
 	q := url.Values{}
 	q.Set("appid", c.corpID)
 	q.Set("redirect_uri", redirectURI)
 	q.Set("response_type", "code")
-	q.Set("scope", "snsapi_base")
+	q.Set("scope", c.oauthScope)
 	q.Set("agentid", c.agentID)
 	q.Set("state", state)
 
@@ -35,29 +101,94 @@ func (c *Client) GetOAuthURL(redirectURI, state string) string {
 }
 
 type GetUserInfoResponse struct {
-	Code    int    `json:"errcode,omitempty"`
-	Message string `json:"errmsg,omitempty"`
-	UserID  string `json:"UserId,omitempty"`
+	Code       int    `json:"errcode,omitempty"`
+	Message    string `json:"errmsg,omitempty"`
+	UserID     string `json:"UserId,omitempty"`
+	OpenID     string `json:"OpenId,omitempty"`
+	ExternalID string `json:"external_userid,omitempty"`
+	DeviceID   string `json:"DeviceId,omitempty"`
+	UserTicket string `json:"user_ticket,omitempty"`
+	ExpiresIn  int    `json:"expires_in,omitempty"`
 }
 
 func (c *Client) GetUserInfo(code string) (string, error) {
+	return c.GetUserInfoContext(context.Background(), code)
+}
+
+func (c *Client) GetUserInfoContext(ctx context.Context, code string) (string, error) {
+	resp, err := c.AuthenticateContext(ctx, code)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.UserID, nil
+}
+
+// Authenticate exchanges an oauth code for the identity of the user. The
+// response carries a user ticket for GetUserDetail if the code was issued
+// with ScopePrivateInfo.
+//
+// If the user is not a member of the corp, the response identifying it by
+// OpenID is returned along with ErrNotMember.
+func (c *Client) Authenticate(code string) (*GetUserInfoResponse, error) {
+	return c.AuthenticateContext(context.Background(), code)
+}
+
+func (c *Client) AuthenticateContext(ctx context.Context, code string) (*GetUserInfoResponse, error) {
 	q := url.Values{}
 	q.Set("code", code)
 
-	u := fmt.Sprintf("%s?%s", userInfoURL, q.Encode())
+	u := fmt.Sprintf("%s?%s", userInfoPath, q.Encode())
 
 	var resp GetUserInfoResponse
-	if err := c.getJSON(u, &resp); err != nil {
-		return "", err
+	if err := c.getJSON(ctx, CredentialApp, u, &resp); err != nil {
+		return nil, err
 	}
 
-	if resp.Code != 0 {
-		return "", fmt.Errorf("Get user info error: %v %v", resp.Code, resp.Message)
+	if resp.UserID == "" {
+		return &resp, ErrNotMember
 	}
 
-	if resp.UserID == "" {
-		return "", errors.New("User is not wework member")
+	return &resp, nil
+}
+
+type GetUserDetailRequest struct {
+	UserTicket string `json:"user_ticket"`
+}
+
+// UserDetail is the sensitive profile the user granted access to.
+type UserDetail struct {
+	UserID  string `json:"userid,omitempty"`
+	Gender  Gender `json:"gender,omitempty"`
+	Avatar  string `json:"avatar,omitempty"`
+	QRCode  string `json:"qr_code,omitempty"`
+	Mobile  string `json:"mobile,omitempty"`
+	Email   string `json:"email,omitempty"`
+	BizMail string `json:"biz_mail,omitempty"`
+	Address string `json:"address,omitempty"`
+}
+
+type GetUserDetailResponse struct {
+	Code    int    `json:"errcode,omitempty"`
+	Message string `json:"errmsg,omitempty"`
+	UserDetail
+}
+
+// GetUserDetail returns the sensitive profile of the user identified by a
+// user ticket obtained from Authenticate.
+func (c *Client) GetUserDetail(userTicket string) (*UserDetail, error) {
+	return c.GetUserDetailContext(context.Background(), userTicket)
+}
+
+func (c *Client) GetUserDetailContext(ctx context.Context, userTicket string) (*UserDetail, error) {
+	req := GetUserDetailRequest{
+		UserTicket: userTicket,
 	}
 
-	return resp.UserID, nil
+	var resp GetUserDetailResponse
+	if err := c.postJSON(ctx, CredentialApp, userDetailPath, &req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.UserDetail, nil
 }
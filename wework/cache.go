@@ -0,0 +1,99 @@
+package wework
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// cacheLoadTimeout bounds a load shared by the readers of a cache, so it
+	// does not depend on the context of the reader that started it.
+	cacheLoadTimeout = time.Minute
+)
+
+// cachedValue holds a value loaded on demand and kept for ttl. Concurrent
+// readers of an expired value share a single load, made without holding the
+// lock.
+type cachedValue struct {
+	ttl      time.Duration
+	load     func(ctx context.Context) (interface{}, error)
+	mu       *sync.Mutex
+	value    interface{}
+	loadedAt time.Time
+	gen      int
+	inflight *cacheLoad
+}
+
+type cacheLoad struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func newCachedValue(ttl time.Duration, load func(ctx context.Context) (interface{}, error)) *cachedValue {
+	return &cachedValue{
+		ttl:  ttl,
+		load: load,
+		mu:   &sync.Mutex{},
+	}
+}
+
+// get returns the cached value, loading it if it is missing or older than
+// ttl. It gives up with the error of ctx once ctx is done, leaving the load
+// to complete for other readers.
+func (v *cachedValue) get(ctx context.Context) (interface{}, error) {
+	v.mu.Lock()
+	if v.value != nil && time.Since(v.loadedAt) < v.ttl {
+		value := v.value
+		v.mu.Unlock()
+		return value, nil
+	}
+
+	call := v.inflight
+	if call == nil {
+		call = &cacheLoad{done: make(chan struct{})}
+		v.inflight = call
+		go v.doLoad(call, v.gen)
+	}
+	v.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (v *cachedValue) doLoad(call *cacheLoad, gen int) {
+	ctx, cancel := context.WithTimeout(context.Background(), cacheLoadTimeout)
+	defer cancel()
+
+	call.value, call.err = v.load(ctx)
+
+	v.mu.Lock()
+	if v.inflight == call {
+		v.inflight = nil
+	}
+
+	// A value loaded before an invalidation may be stale, so it is handed to
+	// the waiting readers but not kept.
+	if call.err == nil && gen == v.gen {
+		v.value = call.value
+		v.loadedAt = time.Now()
+	}
+	v.mu.Unlock()
+
+	close(call.done)
+}
+
+// invalidate drops the cached value so the next read reloads it.
+func (v *cachedValue) invalidate() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.value = nil
+	v.inflight = nil
+	v.gen++
+}
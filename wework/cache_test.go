@@ -0,0 +1,110 @@
+package wework
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCachedValueCollapsesLoads(t *testing.T) {
+	var loads int32
+	release := make(chan struct{})
+
+	v := newCachedValue(time.Hour, func(ctx context.Context) (interface{}, error) {
+		n := atomic.AddInt32(&loads, 1)
+		<-release
+		return n, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := v.get(context.Background()); err != nil || got != int32(1) {
+				t.Errorf("get = %v, %v, want 1", got, err)
+			}
+		}()
+	}
+
+	waitFor(t, func() bool { return atomic.LoadInt32(&loads) > 0 })
+	close(release)
+	wg.Wait()
+
+	if got, err := v.get(context.Background()); err != nil || got != int32(1) {
+		t.Errorf("cached get = %v, %v, want 1", got, err)
+	}
+
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("loads = %d, want 1", n)
+	}
+}
+
+func TestCachedValueInvalidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		duringGet bool
+		wantLoads int32
+	}{
+		{"after load", false, 2},
+		{"during load", true, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var loads int32
+			release := make(chan struct{}, 2)
+
+			v := newCachedValue(time.Hour, func(ctx context.Context) (interface{}, error) {
+				n := atomic.AddInt32(&loads, 1)
+				<-release
+				return n, nil
+			})
+
+			if tt.duringGet {
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					v.get(context.Background())
+				}()
+
+				waitFor(t, func() bool { return atomic.LoadInt32(&loads) == 1 })
+				v.invalidate()
+				release <- struct{}{}
+				<-done
+			} else {
+				release <- struct{}{}
+				v.get(context.Background())
+				v.invalidate()
+			}
+
+			release <- struct{}{}
+			if got, err := v.get(context.Background()); err != nil || got != int32(2) {
+				t.Errorf("get after invalidate = %v, %v, want 2", got, err)
+			}
+
+			if n := atomic.LoadInt32(&loads); n != tt.wantLoads {
+				t.Errorf("loads = %d, want %d", n, tt.wantLoads)
+			}
+		})
+	}
+}
+
+func TestCachedValueHonoursContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	v := newCachedValue(time.Hour, func(ctx context.Context) (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := v.get(ctx); err != context.DeadlineExceeded {
+		t.Errorf("get error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
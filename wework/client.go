@@ -1,30 +1,193 @@
 package wework
 
 import (
-	"sync"
-	"time"
+	"net/http"
+	"strings"
+)
+
+const (
+	DefaultBaseURL = "https://qyapi.weixin.qq.com"
+)
+
+// Credential names a secret of the corp. Each secret has its own access
+// token and api permissions, and every api declares the one it needs.
+type Credential string
+
+const (
+	// CredentialApp is the secret of the app passed to NewClient.
+	CredentialApp Credential = "app"
+
+	// CredentialContacts is the secret of the contacts sync app, which can
+	// read the whole directory rather than the visible range of the app.
+	CredentialContacts Credential = "contacts"
+
+	// CredentialApproval is the secret of the approval app, which can submit
+	// and read approvals.
+	CredentialApproval Credential = "approval"
 )
 
 type Client struct {
-	corpID      string
-	agentID     string
-	agentSecret string
-	tokenHolder *tokenHolder
+	corpID       string
+	agentID      string
+	secrets      map[Credential]string
+	credentials  map[Credential]*tokenHolder
+	baseURL      string
+	httpClient   *http.Client
+	refreshRatio float64
+	tokenStore   TokenStore
+	tokenHolder  *tokenHolder
+	holders      []*tokenHolder
+	retryPolicy  RetryPolicy
+	limiter      *rateLimiter
+	oauthScope   string
+}
+
+// Option configures optional Client settings.
+type Option func(*Client)
+
+// WithHTTPClient sets the http.Client used for all API calls.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		if hc != nil {
+			c.httpClient = hc
+		}
+	}
+}
+
+// WithBaseURL overrides the API base url, e.g. for private deployments.
+func WithBaseURL(u string) Option {
+	return func(c *Client) {
+		if u != "" {
+			c.baseURL = strings.TrimRight(u, "/")
+		}
+	}
 }
 
-type tokenHolder struct {
-	mu        *sync.Mutex
-	token     string
-	expiresAt time.Time
+// WithTokenRefreshRatio sets the fraction of the access token lifetime after
+// which it is renewed in the background.
+func WithTokenRefreshRatio(r float64) Option {
+	return func(c *Client) {
+		c.refreshRatio = r
+	}
+}
+
+// WithTokenStore sets the store through which access tokens are shared.
+func WithTokenStore(s TokenStore) Option {
+	return func(c *Client) {
+		if s != nil {
+			c.tokenStore = s
+		}
+	}
+}
+
+// WithRetryPolicy sets how calls failing with retryable errors are retried.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.retryPolicy = p
+	}
+}
+
+// WithRateLimit limits the calls made to each endpoint to perMinute. A
+// non-positive perMinute disables limiting.
+func WithRateLimit(perMinute int) Option {
+	return func(c *Client) {
+		c.limiter.perMinute = perMinute
+	}
+}
+
+// WithEndpointRateLimit limits the calls made to the api at path, e.g.
+// user/get, to perMinute instead of the limit of WithRateLimit. A
+// non-positive perMinute disables limiting it.
+func WithEndpointRateLimit(path string, perMinute int) Option {
+	return func(c *Client) {
+		c.limiter.limits[apiPath(path)] = perMinute
+	}
 }
 
-func NewClient(corpID, agentID, agentSecret string) *Client {
-	return &Client{
-		corpID:      corpID,
-		agentID:     agentID,
-		agentSecret: agentSecret,
-		tokenHolder: &tokenHolder{
-			mu: &sync.Mutex{},
-		},
+// WithOAuthScope sets the scope requested by GetOAuthURL. It defaults to
+// ScopeBase.
+func WithOAuthScope(scope string) Option {
+	return func(c *Client) {
+		if scope != "" {
+			c.oauthScope = scope
+		}
 	}
 }
+
+// WithCredential sets the secret of credential name. Apis declaring a
+// credential without a secret use the app credential.
+func WithCredential(name Credential, secret string) Option {
+	return func(c *Client) {
+		if secret != "" {
+			c.secrets[name] = secret
+		}
+	}
+}
+
+func NewClient(corpID, agentID, agentSecret string, opts ...Option) *Client {
+	c := newClient(corpID, agentID, opts)
+	c.tokenHolder = c.newTokenHolder(c.tokenKey(), c.fetchAccessToken(agentSecret))
+
+	for name, secret := range c.secrets {
+		if name != CredentialApp {
+			c.credentials[name] = c.newTokenHolder(c.corpID+"."+string(name), c.fetchAccessToken(secret))
+		}
+	}
+
+	return c
+}
+
+// newClient returns a client without credentials. Callers set tokenHolder,
+// and the secrets of other credentials are left to NewClient.
+func newClient(corpID, agentID string, opts []Option) *Client {
+	c := &Client{
+		corpID:       corpID,
+		agentID:      agentID,
+		secrets:      make(map[Credential]string),
+		credentials:  make(map[Credential]*tokenHolder),
+		baseURL:      DefaultBaseURL,
+		httpClient:   http.DefaultClient,
+		refreshRatio: DefaultTokenRefreshRatio,
+		tokenStore:   NewMemoryTokenStore(),
+		retryPolicy:  DefaultRetryPolicy,
+		limiter:      newRateLimiter(DefaultRateLimit),
+		oauthScope:   ScopeBase,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// newTokenHolder returns a holder for tokens obtained with fetch, stopped
+// when the client is closed.
+func (c *Client) newTokenHolder(key string, fetch tokenFetcher) *tokenHolder {
+	h := newTokenHolder(key, c.tokenStore, fetch, c.refreshRatio)
+	c.holders = append(c.holders, h)
+	return h
+}
+
+// holder returns the token holder of cred, falling back to the app
+// credential.
+func (c *Client) holder(cred Credential) *tokenHolder {
+	if h, ok := c.credentials[cred]; ok {
+		return h
+	}
+
+	return c.tokenHolder
+}
+
+func (c *Client) tokenKey() string {
+	return c.corpID + "." + c.agentID
+}
+
+// Close stops the background token refreshers.
+func (c *Client) Close() error {
+	for _, h := range c.holders {
+		h.close()
+	}
+
+	return nil
+}
@@ -0,0 +1,204 @@
+// Package crypto implements the wework callback message encryption scheme
+// (WXBizMsgCrypt): sha1 signatures over the token, timestamp, nonce and
+// payload, and AES-256-CBC encryption keyed by the EncodingAESKey.
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	encodingAESKeyLen = 43
+	blockSize         = 32
+	randomLen         = 16
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrInvalidReceiver  = errors.New("invalid receiver id")
+	ErrInvalidPadding   = errors.New("invalid padding")
+	ErrInvalidMessage   = errors.New("invalid message")
+)
+
+// MsgCrypt signs, verifies, encrypts and decrypts callback messages of one
+// receiver, which is the corp id for self-built apps or the suite id for
+// service providers.
+type MsgCrypt struct {
+	token      string
+	key        []byte
+	receiverID string
+}
+
+func New(token, encodingAESKey, receiverID string) (*MsgCrypt, error) {
+	if len(encodingAESKey) != encodingAESKeyLen {
+		return nil, fmt.Errorf("illegal encoding aes key length: %v", len(encodingAESKey))
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encodingAESKey + "=")
+	if err != nil {
+		return nil, fmt.Errorf("illegal encoding aes key: %v", err)
+	}
+
+	return &MsgCrypt{
+		token:      token,
+		key:        key,
+		receiverID: receiverID,
+	}, nil
+}
+
+// Signature returns the signature of data sent at timestamp with nonce.
+func (c *MsgCrypt) Signature(timestamp, nonce, data string) string {
+	parts := []string{c.token, timestamp, nonce, data}
+	sort.Strings(parts)
+
+	sum := sha1.Sum([]byte(strings.Join(parts, "")))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifySignature reports whether signature matches data.
+func (c *MsgCrypt) VerifySignature(signature, timestamp, nonce, data string) bool {
+	expected := c.Signature(timestamp, nonce, data)
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) == 1
+}
+
+// Decrypt decrypts a base64 encoded payload and returns the message it
+// carries.
+func (c *MsgCrypt) Decrypt(encrypted string) ([]byte, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("base64 decode error: %v", err)
+	}
+
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, ErrInvalidMessage
+	}
+
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return nil, err
+	}
+
+	plain := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, c.key[:aes.BlockSize]).CryptBlocks(plain, ciphertext)
+
+	plain, err = unpad(plain)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(plain) < randomLen+4 {
+		return nil, ErrInvalidMessage
+	}
+
+	msgLen := int(binary.BigEndian.Uint32(plain[randomLen : randomLen+4]))
+	rest := plain[randomLen+4:]
+	if msgLen > len(rest) {
+		return nil, ErrInvalidMessage
+	}
+
+	msg, receiverID := rest[:msgLen], rest[msgLen:]
+	if string(receiverID) != c.receiverID {
+		return nil, ErrInvalidReceiver
+	}
+
+	return msg, nil
+}
+
+// Encrypt encrypts msg and returns it base64 encoded.
+func (c *MsgCrypt) Encrypt(msg []byte) (string, error) {
+	buf := new(bytes.Buffer)
+
+	random := make([]byte, randomLen)
+	if _, err := io.ReadFull(rand.Reader, random); err != nil {
+		return "", err
+	}
+
+	buf.Write(random)
+	binary.Write(buf, binary.BigEndian, uint32(len(msg)))
+	buf.Write(msg)
+	buf.WriteString(c.receiverID)
+
+	plain := pad(buf.Bytes())
+
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, c.key[:aes.BlockSize]).CryptBlocks(ciphertext, plain)
+
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// VerifyURL handles the url verification handshake, returning the echo
+// string to respond with.
+func (c *MsgCrypt) VerifyURL(signature, timestamp, nonce, echostr string) ([]byte, error) {
+	if !c.VerifySignature(signature, timestamp, nonce, echostr) {
+		return nil, ErrInvalidSignature
+	}
+
+	return c.Decrypt(echostr)
+}
+
+type envelope struct {
+	XMLName    xml.Name `xml:"xml"`
+	ToUserName string   `xml:"ToUserName"`
+	AgentID    string   `xml:"AgentID"`
+	Encrypt    string   `xml:"Encrypt"`
+}
+
+// DecryptMessage verifies and decrypts the xml body of a callback request,
+// returning the xml message it carries.
+func (c *MsgCrypt) DecryptMessage(signature, timestamp, nonce string, body []byte) ([]byte, error) {
+	var env envelope
+	if err := xml.Unmarshal(body, &env); err != nil {
+		return nil, fmt.Errorf("xml.Unmarshal error: %v", err)
+	}
+
+	if !c.VerifySignature(signature, timestamp, nonce, env.Encrypt) {
+		return nil, ErrInvalidSignature
+	}
+
+	return c.Decrypt(env.Encrypt)
+}
+
+// pad applies PKCS#7 padding to a multiple of 32 bytes, as the scheme
+// requires.
+func pad(b []byte) []byte {
+	n := blockSize - len(b)%blockSize
+	return append(b, bytes.Repeat([]byte{byte(n)}, n)...)
+}
+
+func unpad(b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return nil, ErrInvalidPadding
+	}
+
+	n := int(b[len(b)-1])
+	if n < 1 || n > blockSize || n > len(b) {
+		return nil, ErrInvalidPadding
+	}
+
+	for _, p := range b[len(b)-n:] {
+		if int(p) != n {
+			return nil, ErrInvalidPadding
+		}
+	}
+
+	return b[:len(b)-n], nil
+}
@@ -0,0 +1,175 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"testing"
+)
+
+const (
+	testToken     = "QDG6eK"
+	testAESKey    = "jWmYm7qr5nMoAUwZRjGtBxmz3KA1tkAj3ykkR6q2B2C"
+	testReceiver  = "wx5823bf96d3bd56c7"
+	testTimestamp = "1409659813"
+	testNonce     = "1372623149"
+
+	// testEncrypted is testMessage encrypted for testReceiver with the
+	// random prefix "aaaabbbbccccdddd", and testSignature its signature.
+	testMessage   = "<xml><Event>delete_user</Event></xml>"
+	testEncrypted = "ZA4HuQypHxnRrA+A6SOHGJ7E92StOyYieAlh+4qD8jSkXN4EpvqJTsVGKGrV5RhaP7uUnNUPpciR66AVIknbi7+fkHm1/tDRM96pQ3UZe6T15H/k8dwl2OLDfi8Yy/B+"
+	testSignature = "6d1be439f10ef751deec729b6462e4431f764d3a"
+)
+
+func newTestCrypt(t *testing.T, receiverID string) *MsgCrypt {
+	c, err := New(testToken, testAESKey, receiverID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+// encryptRaw encrypts plain as is, without framing or padding it.
+func encryptRaw(t *testing.T, c *MsgCrypt, plain []byte) string {
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, c.key[:aes.BlockSize]).CryptBlocks(ciphertext, plain)
+	return base64.StdEncoding.EncodeToString(ciphertext)
+}
+
+func TestKnownVector(t *testing.T) {
+	c := newTestCrypt(t, testReceiver)
+
+	if sig := c.Signature(testTimestamp, testNonce, testEncrypted); sig != testSignature {
+		t.Errorf("Signature = %v, want %v", sig, testSignature)
+	}
+
+	msg, err := c.VerifyURL(testSignature, testTimestamp, testNonce, testEncrypted)
+	if err != nil {
+		t.Fatalf("VerifyURL error: %v", err)
+	}
+
+	if string(msg) != testMessage {
+		t.Errorf("VerifyURL = %q, want %q", msg, testMessage)
+	}
+
+	body := []byte("<xml><ToUserName><![CDATA[" + testReceiver + "]]></ToUserName><Encrypt><![CDATA[" + testEncrypted + "]]></Encrypt></xml>")
+	msg, err = c.DecryptMessage(testSignature, testTimestamp, testNonce, body)
+	if err != nil {
+		t.Fatalf("DecryptMessage error: %v", err)
+	}
+
+	if string(msg) != testMessage {
+		t.Errorf("DecryptMessage = %q, want %q", msg, testMessage)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := newTestCrypt(t, testReceiver)
+
+	tests := []string{"", "a", testMessage, string(bytes.Repeat([]byte("x"), 1000))}
+	for _, want := range tests {
+		encrypted, err := c.Encrypt([]byte(want))
+		if err != nil {
+			t.Fatalf("Encrypt error: %v", err)
+		}
+
+		got, err := c.Decrypt(encrypted)
+		if err != nil {
+			t.Fatalf("Decrypt error: %v", err)
+		}
+
+		if string(got) != want {
+			t.Errorf("Decrypt = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestRejects(t *testing.T) {
+	c := newTestCrypt(t, testReceiver)
+
+	padded := func(pad ...byte) string {
+		plain := bytes.Repeat([]byte("a"), 2*blockSize-len(pad))
+		return encryptRaw(t, c, append(plain, pad...))
+	}
+
+	tests := []struct {
+		name      string
+		crypt     *MsgCrypt
+		signature string
+		encrypted string
+		want      error
+	}{
+		{
+			name:      "bad signature",
+			crypt:     c,
+			signature: "0000000000000000000000000000000000000000",
+			encrypted: testEncrypted,
+			want:      ErrInvalidSignature,
+		},
+		{
+			name:      "wrong receiver",
+			crypt:     newTestCrypt(t, "ww0000000000000000"),
+			encrypted: testEncrypted,
+			want:      ErrInvalidReceiver,
+		},
+		{
+			name:      "zero padding",
+			crypt:     c,
+			encrypted: padded(0),
+			want:      ErrInvalidPadding,
+		},
+		{
+			name:      "padding over block size",
+			crypt:     c,
+			encrypted: padded(blockSize + 1),
+			want:      ErrInvalidPadding,
+		},
+		{
+			name:      "inconsistent padding",
+			crypt:     c,
+			encrypted: padded(1, 3, 3),
+			want:      ErrInvalidPadding,
+		},
+		{
+			name:      "truncated message",
+			crypt:     c,
+			encrypted: encryptRaw(t, c, pad([]byte("aaaabbbbccccdddd\x00\x00\x01\x00"))),
+			want:      ErrInvalidMessage,
+		},
+		{
+			name:      "partial block",
+			crypt:     c,
+			encrypted: base64.StdEncoding.EncodeToString([]byte("short")),
+			want:      ErrInvalidMessage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signature := tt.signature
+			if signature == "" {
+				signature = tt.crypt.Signature(testTimestamp, testNonce, tt.encrypted)
+			}
+
+			if _, err := tt.crypt.VerifyURL(signature, testTimestamp, testNonce, tt.encrypted); err != tt.want {
+				t.Errorf("VerifyURL error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRejectsKey(t *testing.T) {
+	tests := []string{"", testAESKey[:42], testAESKey + "A", "!" + testAESKey[1:]}
+	for _, key := range tests {
+		if _, err := New(testToken, key, testReceiver); err == nil {
+			t.Errorf("New with key %q succeeded, want error", key)
+		}
+	}
+}
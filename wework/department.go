@@ -0,0 +1,198 @@
+package wework
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+const (
+	listDepartmentsPath = "/cgi-bin/department/list"
+	getDepartmentPath   = "/cgi-bin/department/get"
+
+	// RootDepartmentID is the id of the department representing the corp.
+	RootDepartmentID = 1
+)
+
+type Department struct {
+	ID       int      `json:"id"`
+	Name     string   `json:"name"`
+	NameEn   string   `json:"name_en,omitempty"`
+	Leaders  []string `json:"department_leader,omitempty"`
+	ParentID int      `json:"parentid"`
+	Order    int      `json:"order"`
+}
+
+type ListDepartmentsResponse struct {
+	Code        int          `json:"errcode,omitempty"`
+	Message     string       `json:"errmsg,omitempty"`
+	Departments []Department `json:"department,omitempty"`
+}
+
+type GetDepartmentResponse struct {
+	Code       int        `json:"errcode,omitempty"`
+	Message    string     `json:"errmsg,omitempty"`
+	Department Department `json:"department"`
+}
+
+// ListDepartments returns the department id and all its descendants. If id
+// is 0, all departments visible to the app are returned.
+func (c *Client) ListDepartments(id int) ([]Department, error) {
+	return c.ListDepartmentsContext(context.Background(), id)
+}
+
+func (c *Client) ListDepartmentsContext(ctx context.Context, id int) ([]Department, error) {
+	u := listDepartmentsPath
+	if id != 0 {
+		q := url.Values{}
+		q.Set("id", strconv.Itoa(id))
+		u += "?" + q.Encode()
+	}
+
+	var resp ListDepartmentsResponse
+	if err := c.getJSON(ctx, CredentialContacts, u, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Departments, nil
+}
+
+func (c *Client) GetDepartment(id int) (*Department, error) {
+	return c.GetDepartmentContext(context.Background(), id)
+}
+
+func (c *Client) GetDepartmentContext(ctx context.Context, id int) (*Department, error) {
+	q := url.Values{}
+	q.Set("id", strconv.Itoa(id))
+
+	u := getDepartmentPath + "?" + q.Encode()
+
+	var resp GetDepartmentResponse
+	if err := c.getJSON(ctx, CredentialContacts, u, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Department, nil
+}
+
+// DepartmentNode is a department linked to its parent and children.
+type DepartmentNode struct {
+	Department
+
+	// Path is the slash separated names from the top level department down
+	// to this one, e.g. "Engineering/Platform/SRE". The corp root department
+	// is not part of it.
+	Path string
+
+	Parent   *DepartmentNode
+	Children []*DepartmentNode
+}
+
+// Ancestors returns the ids of the parent departments, nearest first.
+func (n *DepartmentNode) Ancestors() []int {
+	var ids []int
+	for p := n.Parent; p != nil; p = p.Parent {
+		ids = append(ids, p.ID)
+	}
+
+	return ids
+}
+
+// DepartmentTree indexes departments by id and links them into a tree.
+type DepartmentTree struct {
+	Roots []*DepartmentNode
+	nodes map[int]*DepartmentNode
+}
+
+// NewDepartmentTree builds a tree from depts. Departments whose parent is not
+// in depts become roots.
+func NewDepartmentTree(depts []Department) *DepartmentTree {
+	t := &DepartmentTree{
+		nodes: make(map[int]*DepartmentNode, len(depts)),
+	}
+
+	for _, d := range depts {
+		t.nodes[d.ID] = &DepartmentNode{Department: d}
+	}
+
+	for _, d := range depts {
+		n := t.nodes[d.ID]
+		if p, ok := t.nodes[d.ParentID]; ok && d.ParentID != d.ID {
+			n.Parent = p
+			p.Children = append(p.Children, n)
+		} else {
+			t.Roots = append(t.Roots, n)
+		}
+	}
+
+	sortNodes(t.Roots)
+	for _, n := range t.Roots {
+		n.Path = rootPath(n)
+		setPaths(n)
+	}
+
+	return t
+}
+
+// Get returns the department id, or nil if it is not in the tree.
+func (t *DepartmentTree) Get(id int) *DepartmentNode {
+	return t.nodes[id]
+}
+
+// Path returns the path of department id, or an empty string if it is not
+// in the tree.
+func (t *DepartmentTree) Path(id int) string {
+	if n := t.nodes[id]; n != nil {
+		return n.Path
+	}
+
+	return ""
+}
+
+func rootPath(n *DepartmentNode) string {
+	if n.ParentID == 0 {
+		return ""
+	}
+
+	return n.Name
+}
+
+func setPaths(n *DepartmentNode) {
+	sortNodes(n.Children)
+	for _, child := range n.Children {
+		if n.Path == "" {
+			child.Path = child.Name
+		} else {
+			child.Path = n.Path + "/" + child.Name
+		}
+
+		setPaths(child)
+	}
+}
+
+// sortNodes orders departments as wework displays them, higher order first.
+func sortNodes(nodes []*DepartmentNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Order != nodes[j].Order {
+			return nodes[i].Order > nodes[j].Order
+		}
+
+		return nodes[i].ID < nodes[j].ID
+	})
+}
+
+// GetDepartmentTree lists all departments visible to the app and links them
+// into a tree.
+func (c *Client) GetDepartmentTree() (*DepartmentTree, error) {
+	return c.GetDepartmentTreeContext(context.Background())
+}
+
+func (c *Client) GetDepartmentTreeContext(ctx context.Context) (*DepartmentTree, error) {
+	depts, err := c.ListDepartmentsContext(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDepartmentTree(depts), nil
+}
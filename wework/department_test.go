@@ -0,0 +1,100 @@
+package wework_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pragkent/hydra-wework/wework"
+)
+
+func TestDepartmentTreePath(t *testing.T) {
+	corp := []wework.Department{
+		{ID: 1, Name: "Corp", ParentID: 0},
+		{ID: 2, Name: "Engineering", ParentID: 1, Order: 2},
+		{ID: 3, Name: "Platform", ParentID: 2},
+		{ID: 4, Name: "SRE", ParentID: 3},
+		{ID: 5, Name: "Sales", ParentID: 1, Order: 1},
+	}
+
+	tests := []struct {
+		name  string
+		depts []wework.Department
+		paths map[int]string
+		roots []int
+	}{
+		{
+			name:  "whole corp",
+			depts: corp,
+			paths: map[int]string{1: "", 2: "Engineering", 3: "Engineering/Platform", 4: "Engineering/Platform/SRE", 5: "Sales"},
+			roots: []int{1},
+		},
+		{
+			name:  "visible subtree",
+			depts: corp[2:4],
+			paths: map[int]string{3: "Platform", 4: "Platform/SRE"},
+			roots: []int{3},
+		},
+		{
+			name:  "disjoint subtrees",
+			depts: []wework.Department{corp[4], corp[3], corp[1]},
+			paths: map[int]string{2: "Engineering", 4: "SRE", 5: "Sales"},
+			roots: []int{2, 5, 4},
+		},
+		{
+			name:  "own parent",
+			depts: []wework.Department{{ID: 7, Name: "Loop", ParentID: 7}},
+			paths: map[int]string{7: "Loop"},
+			roots: []int{7},
+		},
+		{
+			name:  "missing department",
+			depts: corp,
+			paths: map[int]string{42: ""},
+			roots: []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := wework.NewDepartmentTree(tt.depts)
+
+			for id, want := range tt.paths {
+				if got := tree.Path(id); got != want {
+					t.Errorf("Path(%d) = %q, want %q", id, got, want)
+				}
+			}
+
+			var roots []int
+			for _, n := range tree.Roots {
+				roots = append(roots, n.ID)
+			}
+
+			if !reflect.DeepEqual(roots, tt.roots) {
+				t.Errorf("Roots = %v, want %v", roots, tt.roots)
+			}
+		})
+	}
+}
+
+func TestDepartmentNodeAncestors(t *testing.T) {
+	tree := wework.NewDepartmentTree([]wework.Department{
+		{ID: 1, Name: "Corp", ParentID: 0},
+		{ID: 2, Name: "Engineering", ParentID: 1},
+		{ID: 3, Name: "Platform", ParentID: 2},
+	})
+
+	tests := []struct {
+		id   int
+		want []int
+	}{
+		{1, nil},
+		{2, []int{1}},
+		{3, []int{2, 1}},
+	}
+
+	for _, tt := range tests {
+		if got := tree.Get(tt.id).Ancestors(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Ancestors of %d = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package wework
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error codes returned by the wework api in errcode.
+const (
+	ErrCodeSystemBusy        = -1
+	ErrCodeOK                = 0
+	ErrCodeInvalidSecret     = 40001
+	ErrCodeInvalidUserID     = 40003
+	ErrCodeInvalidCorpID     = 40013
+	ErrCodeInvalidToken      = 40014
+	ErrCodeInvalidCode       = 40029
+	ErrCodeInvalidAgentID    = 40056
+	ErrCodeInvalidParameter  = 40058
+	ErrCodeInvalidTagID      = 40068
+	ErrCodeInvalidSuiteToken = 40082
+	ErrCodeInvalidTicket     = 40083
+	ErrCodeMissingToken      = 41001
+	ErrCodeMissingCorpID     = 41002
+	ErrCodeMissingSecret     = 41004
+	ErrCodeTokenExpired      = 42001
+	ErrCodeSuiteTokenExpired = 42009
+	ErrCodeFrequencyLimit    = 45009
+	ErrCodeConcurrencyLimit  = 45033
+	ErrCodeUserNotFound      = 46004
+	ErrCodeAPIForbidden      = 48002
+	ErrCodeRedirectURLDomain = 50001
+	ErrCodeDeptNotFound      = 60003
+	ErrCodeNoPrivilege       = 60011
+	ErrCodeUntrustedIP       = 60020
+	ErrCodeUserIDNotFound    = 60111
+	ErrCodeInvalidDeptID     = 60123
+)
+
+var errCodeMessages = map[int]string{
+	ErrCodeSystemBusy:        "system busy",
+	ErrCodeOK:                "ok",
+	ErrCodeInvalidSecret:     "invalid secret",
+	ErrCodeInvalidUserID:     "invalid userid",
+	ErrCodeInvalidCorpID:     "invalid corpid",
+	ErrCodeInvalidToken:      "invalid access_token",
+	ErrCodeInvalidCode:       "invalid oauth code",
+	ErrCodeInvalidAgentID:    "invalid agentid",
+	ErrCodeInvalidParameter:  "invalid parameter",
+	ErrCodeInvalidTagID:      "invalid tagid",
+	ErrCodeInvalidSuiteToken: "invalid suite_access_token",
+	ErrCodeInvalidTicket:     "invalid suite_ticket",
+	ErrCodeMissingToken:      "missing access_token",
+	ErrCodeMissingCorpID:     "missing corpid",
+	ErrCodeMissingSecret:     "missing secret",
+	ErrCodeTokenExpired:      "access_token expired",
+	ErrCodeSuiteTokenExpired: "suite_access_token expired",
+	ErrCodeFrequencyLimit:    "api frequency limit exceeded",
+	ErrCodeConcurrencyLimit:  "api concurrency limit exceeded",
+	ErrCodeUserNotFound:      "user not found",
+	ErrCodeAPIForbidden:      "api forbidden",
+	ErrCodeRedirectURLDomain: "redirect_uri domain not trusted",
+	ErrCodeDeptNotFound:      "department not found",
+	ErrCodeNoPrivilege:       "no privilege to access the member, department or tag",
+	ErrCodeUntrustedIP:       "untrusted ip",
+	ErrCodeUserIDNotFound:    "userid not found",
+	ErrCodeInvalidDeptID:     "invalid department id",
+}
+
+// ErrNotMember is returned by GetUserInfo when the user authenticated is not
+// a member of the corp.
+var ErrNotMember = errors.New("User is not wework member")
+
+// APIError is returned when the wework api responds with a non-zero errcode.
+type APIError struct {
+	Code     int
+	Message  string
+	Endpoint string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s api error: %d %s", e.Endpoint, e.Code, e.Message)
+}
+
+// Description returns the known meaning of the error code, if any.
+func (e *APIError) Description() string {
+	return ErrCodeText(e.Code)
+}
+
+// ErrCodeText returns a description of a wework error code, or an empty
+// string if the code is unknown.
+func ErrCodeText(code int) string {
+	return errCodeMessages[code]
+}
+
+// StatusError is returned when the wework api responds with an http status
+// other than 200.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("illegal http status code: %v", e.StatusCode)
+}
+
+func newAPIError(endpoint string, code int, message string) *APIError {
+	if message == "" {
+		message = ErrCodeText(code)
+	}
+
+	return &APIError{
+		Code:     code,
+		Message:  message,
+		Endpoint: endpoint,
+	}
+}
+
+// ErrorCode returns the wework error code carried by err, or ErrCodeOK if err
+// is not an *APIError.
+func ErrorCode(err error) int {
+	if e, ok := err.(*APIError); ok {
+		return e.Code
+	}
+
+	return ErrCodeOK
+}
+
+// IsRetryable reports whether the request may succeed if sent again later.
+func IsRetryable(err error) bool {
+	if e, ok := err.(*StatusError); ok {
+		return e.StatusCode >= http.StatusInternalServerError || e.StatusCode == http.StatusTooManyRequests
+	}
+
+	switch ErrorCode(err) {
+	case ErrCodeSystemBusy, ErrCodeFrequencyLimit, ErrCodeConcurrencyLimit:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsAuthError reports whether err is caused by invalid app credentials or
+// access token.
+func IsAuthError(err error) bool {
+	switch ErrorCode(err) {
+	case ErrCodeInvalidSecret, ErrCodeInvalidCorpID, ErrCodeInvalidAgentID,
+		ErrCodeMissingCorpID, ErrCodeMissingSecret, ErrCodeUntrustedIP, ErrCodeInvalidTicket:
+		return true
+	default:
+		return isTokenError(ErrorCode(err))
+	}
+}
+
+// IsNotFound reports whether err is caused by a missing user or department.
+func IsNotFound(err error) bool {
+	switch ErrorCode(err) {
+	case ErrCodeInvalidUserID, ErrCodeUserNotFound, ErrCodeUserIDNotFound,
+		ErrCodeDeptNotFound, ErrCodeInvalidDeptID:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsInvalidCode reports whether err is caused by an invalid or used oauth code.
+func IsInvalidCode(err error) bool {
+	return ErrorCode(err) == ErrCodeInvalidCode
+}
+
+func isTokenError(code int) bool {
+	switch code {
+	case ErrCodeInvalidToken, ErrCodeTokenExpired, ErrCodeMissingToken,
+		ErrCodeInvalidSuiteToken, ErrCodeSuiteTokenExpired:
+		return true
+	default:
+		return false
+	}
+}
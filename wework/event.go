@@ -0,0 +1,131 @@
+package wework
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	EventChangeContact  = "change_contact"
+	EventApprovalChange = "sys_approval_change"
+
+	InfoSuiteTicket = "suite_ticket"
+
+	ChangeCreateUser  = "create_user"
+	ChangeUpdateUser  = "update_user"
+	ChangeDeleteUser  = "delete_user"
+	ChangeCreateParty = "create_party"
+	ChangeUpdateParty = "update_party"
+	ChangeDeleteParty = "delete_party"
+	ChangeUpdateTag   = "update_tag"
+)
+
+// Event is a callback message pushed by wework, decrypted.
+type Event struct {
+	ToUserName   string `xml:"ToUserName"`
+	FromUserName string `xml:"FromUserName"`
+	CreateTime   int64  `xml:"CreateTime"`
+	MsgType      string `xml:"MsgType"`
+	Event        string `xml:"Event"`
+	ChangeType   string `xml:"ChangeType"`
+
+	// Set for user changes.
+	UserID         string `xml:"UserID"`
+	NewUserID      string `xml:"NewUserID"`
+	Name           string `xml:"Name"`
+	Department     string `xml:"Department"`
+	MainDepartment int    `xml:"MainDepartment"`
+	Status         int    `xml:"Status"`
+
+	// Set for department changes.
+	ID       int    `xml:"Id"`
+	ParentID string `xml:"ParentId"`
+
+	// Set for suite callbacks of service providers.
+	SuiteID     string `xml:"SuiteId"`
+	InfoType    string `xml:"InfoType"`
+	SuiteTicket string `xml:"SuiteTicket"`
+	AuthCorpID  string `xml:"AuthCorpId"`
+
+	// Set for tag changes.
+	TagID         int    `xml:"TagId"`
+	AddUserItems  string `xml:"AddUserItems"`
+	DelUserItems  string `xml:"DelUserItems"`
+	AddPartyItems string `xml:"AddPartyItems"`
+	DelPartyItems string `xml:"DelPartyItems"`
+
+	// Set for approval changes.
+	ApprovalInfo *ApprovalInfo `xml:"ApprovalInfo"`
+}
+
+// ApprovalInfo is the approval whose state changed.
+type ApprovalInfo struct {
+	SpNo       string         `xml:"SpNo"`
+	SpName     string         `xml:"SpName"`
+	SpStatus   ApprovalStatus `xml:"SpStatus"`
+	TemplateID string         `xml:"TemplateId"`
+	ApplyTime  int64          `xml:"ApplyTime"`
+	Applyer    struct {
+		UserID string `xml:"UserId"`
+		Party  string `xml:"Party"`
+	} `xml:"Applyer"`
+}
+
+func ParseEvent(data []byte) (*Event, error) {
+	var ev Event
+	if err := xml.Unmarshal(data, &ev); err != nil {
+		return nil, fmt.Errorf("xml.Unmarshal error: %v", err)
+	}
+
+	return &ev, nil
+}
+
+// IsContactChange reports whether ev is a change_contact event.
+func (ev *Event) IsContactChange() bool {
+	return ev.MsgType == "event" && ev.Event == EventChangeContact
+}
+
+// IsApprovalChange reports whether ev is a sys_approval_change event.
+func (ev *Event) IsApprovalChange() bool {
+	return ev.MsgType == "event" && ev.Event == EventApprovalChange && ev.ApprovalInfo != nil
+}
+
+// IsUserChange reports whether ev is about a member being created, updated
+// or deleted.
+func (ev *Event) IsUserChange() bool {
+	switch ev.ChangeType {
+	case ChangeCreateUser, ChangeUpdateUser, ChangeDeleteUser:
+		return ev.IsContactChange()
+	default:
+		return false
+	}
+}
+
+// IsDepartmentChange reports whether ev is about a department being created,
+// updated or deleted.
+func (ev *Event) IsDepartmentChange() bool {
+	switch ev.ChangeType {
+	case ChangeCreateParty, ChangeUpdateParty, ChangeDeleteParty:
+		return ev.IsContactChange()
+	default:
+		return false
+	}
+}
+
+// Departments returns the department ids of a user change.
+func (ev *Event) Departments() []int {
+	return splitInts(ev.Department)
+}
+
+func splitInts(s string) []int {
+	var ids []int
+	for _, f := range strings.Split(s, ",") {
+		if id, err := strconv.Atoi(strings.TrimSpace(f)); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
@@ -0,0 +1,107 @@
+package wework
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	sendMessagePath = "/cgi-bin/message/send"
+)
+
+type MessageType string
+
+const (
+	MessageText     MessageType = "text"
+	MessageTextCard MessageType = "textcard"
+	MessageMarkdown MessageType = "markdown"
+)
+
+// Message is an app message. Recipients are "|" separated ids; ToUser may be
+// "@all" to message everyone in the visible range of the app.
+type Message struct {
+	ToUser   string           `json:"touser,omitempty"`
+	ToParty  string           `json:"toparty,omitempty"`
+	ToTag    string           `json:"totag,omitempty"`
+	MsgType  MessageType      `json:"msgtype"`
+	AgentID  int              `json:"agentid"`
+	Text     *TextContent     `json:"text,omitempty"`
+	TextCard *TextCardContent `json:"textcard,omitempty"`
+	Markdown *TextContent     `json:"markdown,omitempty"`
+	Safe     int              `json:"safe,omitempty"`
+}
+
+type TextContent struct {
+	Content string `json:"content"`
+}
+
+type TextCardContent struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	ButtonText  string `json:"btntxt,omitempty"`
+}
+
+type SendMessageResponse struct {
+	Code         int    `json:"errcode,omitempty"`
+	Message      string `json:"errmsg,omitempty"`
+	InvalidUser  string `json:"invaliduser,omitempty"`
+	InvalidParty string `json:"invalidparty,omitempty"`
+	InvalidTag   string `json:"invalidtag,omitempty"`
+	MsgID        string `json:"msgid,omitempty"`
+}
+
+func NewTextMessage(content string, users ...string) *Message {
+	return &Message{
+		ToUser:  JoinIDs(users),
+		MsgType: MessageText,
+		Text:    &TextContent{Content: content},
+	}
+}
+
+func NewTextCardMessage(card TextCardContent, users ...string) *Message {
+	return &Message{
+		ToUser:   JoinIDs(users),
+		MsgType:  MessageTextCard,
+		TextCard: &card,
+	}
+}
+
+func NewMarkdownMessage(content string, users ...string) *Message {
+	return &Message{
+		ToUser:   JoinIDs(users),
+		MsgType:  MessageMarkdown,
+		Markdown: &TextContent{Content: content},
+	}
+}
+
+// JoinIDs joins recipient ids the way the message api expects.
+func JoinIDs(ids []string) string {
+	return strings.Join(ids, "|")
+}
+
+// SendMessage sends msg on behalf of the app. Recipients that could not be
+// messaged are reported in the response rather than as an error. It is not
+// retried on retryable errors, to avoid sending msg twice.
+func (c *Client) SendMessage(msg *Message) (*SendMessageResponse, error) {
+	return c.SendMessageContext(context.Background(), msg)
+}
+
+func (c *Client) SendMessageContext(ctx context.Context, msg *Message) (*SendMessageResponse, error) {
+	agentID, err := strconv.Atoi(c.agentID)
+	if err != nil {
+		return nil, fmt.Errorf("illegal agent id: %v", c.agentID)
+	}
+
+	req := *msg
+	req.AgentID = agentID
+
+	var resp SendMessageResponse
+	if err := c.postJSONOnce(ctx, CredentialApp, sendMessagePath, &req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,295 @@
+package wework
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	providerQRConnectURL = "https://open.work.weixin.qq.com/wwopen/sso/3rd_qrConnect"
+
+	getProviderTokenPath = "/cgi-bin/service/get_provider_token"
+	getSuiteTokenPath    = "/cgi-bin/service/get_suite_token"
+	getCorpTokenPath     = "/cgi-bin/service/get_corp_token"
+	getLoginInfoPath     = "/cgi-bin/service/get_login_info"
+
+	suiteTokenParam = "suite_access_token"
+
+	// suiteTicketTTL is how long a suite ticket is valid. Wework pushes a new
+	// one every 10 minutes.
+	suiteTicketTTL = 30 * time.Minute
+)
+
+var (
+	ErrNoSuiteTicket = errors.New("suite ticket not received yet")
+)
+
+// ProviderClient is a client for a wework service provider. It signs users
+// of any authorized corp in, and issues clients for the corps from their
+// permanent codes.
+type ProviderClient struct {
+	client         *Client
+	opts           []Option
+	corpID         string
+	providerSecret string
+	suiteID        string
+	suiteSecret    string
+	providerToken  *tokenHolder
+	suiteToken     *tokenHolder
+
+	mu          *sync.Mutex
+	suiteTicket Token
+	corps       map[string]*Client
+}
+
+// NewProviderClient returns a client for the provider corpID. suiteID and
+// suiteSecret may be empty if no per-corp clients are needed.
+func NewProviderClient(corpID, providerSecret, suiteID, suiteSecret string, opts ...Option) *ProviderClient {
+	p := &ProviderClient{
+		client:         newClient(corpID, "", opts),
+		opts:           opts,
+		corpID:         corpID,
+		providerSecret: providerSecret,
+		suiteID:        suiteID,
+		suiteSecret:    suiteSecret,
+		mu:             &sync.Mutex{},
+		corps:          make(map[string]*Client),
+	}
+
+	p.providerToken = p.client.newTokenHolder("provider."+corpID, p.fetchProviderToken)
+	p.suiteToken = p.client.newTokenHolder("suite."+suiteID, p.fetchSuiteToken)
+	return p
+}
+
+// CorpID returns the corp id of the provider.
+func (p *ProviderClient) CorpID() string {
+	return p.corpID
+}
+
+// SuiteID returns the suite id of the provider app.
+func (p *ProviderClient) SuiteID() string {
+	return p.suiteID
+}
+
+// SetSuiteTicket stores the suite ticket pushed by wework to the suite
+// callback url. It is required to obtain suite access tokens. The ticket is
+// also saved to the token store, so that clients sharing the store can use
+// it, and it survives restarts.
+func (p *ProviderClient) SetSuiteTicket(ticket string) {
+	now := time.Now()
+	t := Token{
+		AccessToken: ticket,
+		ExpiresAt:   now.Add(suiteTicketTTL),
+		RefreshAt:   now,
+	}
+
+	p.mu.Lock()
+	p.suiteTicket = t
+	p.mu.Unlock()
+
+	if err := p.client.tokenStore.Save(p.suiteTicketKey(), &t); err != nil {
+		glog.Warningf("Save suite ticket to store failed. %v", err)
+	}
+}
+
+// loadSuiteTicket returns the latest suite ticket received by this client or
+// saved to the token store, or an empty string if there is none still valid.
+func (p *ProviderClient) loadSuiteTicket() string {
+	p.mu.Lock()
+	t := p.suiteTicket
+	p.mu.Unlock()
+
+	stored, err := p.client.tokenStore.Load(p.suiteTicketKey())
+	if err != nil {
+		glog.Warningf("Load suite ticket from store failed. %v", err)
+	} else if stored != nil && stored.ExpiresAt.After(t.ExpiresAt) {
+		t = *stored
+	}
+
+	if time.Now().After(t.ExpiresAt) {
+		return ""
+	}
+
+	return t.AccessToken
+}
+
+func (p *ProviderClient) suiteTicketKey() string {
+	return "suite_ticket." + p.suiteID
+}
+
+func (p *ProviderClient) GetQRConnectURL(redirectURI, state string) string {
+	q := url.Values{}
+	q.Set("appid", p.corpID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("state", state)
+	q.Set("usertype", "member")
+
+	return fmt.Sprintf("%s?%s", providerQRConnectURL, q.Encode())
+}
+
+type GetLoginInfoRequest struct {
+	AuthCode string `json:"auth_code"`
+}
+
+type LoginUserInfo struct {
+	UserID     string `json:"userid,omitempty"`
+	OpenUserID string `json:"open_userid,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Avatar     string `json:"avatar,omitempty"`
+}
+
+type LoginCorpInfo struct {
+	CorpID string `json:"corpid,omitempty"`
+}
+
+type GetLoginInfoResponse struct {
+	Code     int           `json:"errcode,omitempty"`
+	Message  string        `json:"errmsg,omitempty"`
+	UserType int           `json:"usertype,omitempty"`
+	UserInfo LoginUserInfo `json:"user_info"`
+	CorpInfo LoginCorpInfo `json:"corp_info"`
+}
+
+// GetLoginInfo exchanges the auth code of a 3rd_qrConnect login for the
+// identity of the user and its corp.
+func (p *ProviderClient) GetLoginInfo(authCode string) (*GetLoginInfoResponse, error) {
+	return p.GetLoginInfoContext(context.Background(), authCode)
+}
+
+func (p *ProviderClient) GetLoginInfoContext(ctx context.Context, authCode string) (*GetLoginInfoResponse, error) {
+	req := GetLoginInfoRequest{
+		AuthCode: authCode,
+	}
+
+	var resp GetLoginInfoResponse
+	if err := p.client.postJSONWith(ctx, p.providerToken, accessTokenParam, getLoginInfoPath, &req, &resp); err != nil {
+		return nil, err
+	}
+
+	if resp.UserInfo.UserID == "" {
+		return nil, ErrNotMember
+	}
+
+	return &resp, nil
+}
+
+// CorpClient returns a client for the authorized corp, authenticated with
+// corp tokens obtained from its permanent code. Clients are cached per corp.
+func (p *ProviderClient) CorpClient(authCorpID, permanentCode string) *Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if c, ok := p.corps[authCorpID]; ok {
+		return c
+	}
+
+	c := newClient(authCorpID, "", p.opts)
+	c.tokenHolder = c.newTokenHolder("corp."+p.suiteID+"."+authCorpID, func(ctx context.Context) (string, time.Duration, error) {
+		resp, err := p.GetCorpTokenContext(ctx, authCorpID, permanentCode)
+		if err != nil {
+			return "", 0, err
+		}
+
+		return resp.AccessToken, time.Duration(resp.ExpiresIn) * time.Second, nil
+	})
+
+	p.corps[authCorpID] = c
+	return c
+}
+
+type GetCorpTokenRequest struct {
+	AuthCorpID    string `json:"auth_corpid"`
+	PermanentCode string `json:"permanent_code"`
+}
+
+// GetCorpTokenContext obtains an access token for an authorized corp.
+func (p *ProviderClient) GetCorpTokenContext(ctx context.Context, authCorpID, permanentCode string) (*GetAccessTokenResponse, error) {
+	req := GetCorpTokenRequest{
+		AuthCorpID:    authCorpID,
+		PermanentCode: permanentCode,
+	}
+
+	var resp GetAccessTokenResponse
+	if err := p.client.postJSONWith(ctx, p.suiteToken, suiteTokenParam, getCorpTokenPath, &req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// Close stops the token refreshers of the provider and of all corp clients.
+func (p *ProviderClient) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, c := range p.corps {
+		c.Close()
+	}
+
+	return p.client.Close()
+}
+
+type GetProviderTokenRequest struct {
+	CorpID         string `json:"corpid"`
+	ProviderSecret string `json:"provider_secret"`
+}
+
+type GetProviderTokenResponse struct {
+	Code          int    `json:"errcode,omitempty"`
+	Message       string `json:"errmsg,omitempty"`
+	ProviderToken string `json:"provider_access_token,omitempty"`
+	ExpiresIn     int    `json:"expires_in,omitempty"`
+}
+
+func (p *ProviderClient) fetchProviderToken(ctx context.Context) (string, time.Duration, error) {
+	req := GetProviderTokenRequest{
+		CorpID:         p.corpID,
+		ProviderSecret: p.providerSecret,
+	}
+
+	var resp GetProviderTokenResponse
+	if err := p.client.postJSONNoToken(ctx, getProviderTokenPath, &req, &resp); err != nil {
+		return "", 0, err
+	}
+
+	return resp.ProviderToken, time.Duration(resp.ExpiresIn) * time.Second, nil
+}
+
+type GetSuiteTokenRequest struct {
+	SuiteID     string `json:"suite_id"`
+	SuiteSecret string `json:"suite_secret"`
+	SuiteTicket string `json:"suite_ticket"`
+}
+
+type GetSuiteTokenResponse struct {
+	Code       int    `json:"errcode,omitempty"`
+	Message    string `json:"errmsg,omitempty"`
+	SuiteToken string `json:"suite_access_token,omitempty"`
+	ExpiresIn  int    `json:"expires_in,omitempty"`
+}
+
+func (p *ProviderClient) fetchSuiteToken(ctx context.Context) (string, time.Duration, error) {
+	ticket := p.loadSuiteTicket()
+	if ticket == "" {
+		return "", 0, ErrNoSuiteTicket
+	}
+
+	req := GetSuiteTokenRequest{
+		SuiteID:     p.suiteID,
+		SuiteSecret: p.suiteSecret,
+		SuiteTicket: ticket,
+	}
+
+	var resp GetSuiteTokenResponse
+	if err := p.client.postJSONNoToken(ctx, getSuiteTokenPath, &req, &resp); err != nil {
+		return "", 0, err
+	}
+
+	return resp.SuiteToken, time.Duration(resp.ExpiresIn) * time.Second, nil
+}
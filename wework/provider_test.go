@@ -0,0 +1,42 @@
+package wework
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSuiteTicketSharedThroughStore(t *testing.T) {
+	store := NewMemoryTokenStore()
+
+	a := NewProviderClient("provider", "secret", "suite", "suite-secret", WithTokenStore(store))
+	defer a.Close()
+
+	b := NewProviderClient("provider", "secret", "suite", "suite-secret", WithTokenStore(store))
+	defer b.Close()
+
+	if ticket := b.loadSuiteTicket(); ticket != "" {
+		t.Fatalf("ticket before any was received = %q, want none", ticket)
+	}
+
+	a.SetSuiteTicket("ticket-1")
+	if ticket := b.loadSuiteTicket(); ticket != "ticket-1" {
+		t.Errorf("ticket of other client = %q, want ticket-1", ticket)
+	}
+
+	b.SetSuiteTicket("ticket-2")
+	if ticket := a.loadSuiteTicket(); ticket != "ticket-2" {
+		t.Errorf("ticket after newer one was saved = %q, want ticket-2", ticket)
+	}
+
+	expired := &Token{AccessToken: "ticket-2", ExpiresAt: time.Now().Add(-time.Second)}
+	if err := store.Save(a.suiteTicketKey(), expired); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewProviderClient("provider", "secret", "suite", "suite-secret", WithTokenStore(store))
+	defer c.Close()
+
+	if ticket := c.loadSuiteTicket(); ticket != "" {
+		t.Errorf("expired ticket = %q, want none", ticket)
+	}
+}
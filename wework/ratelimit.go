@@ -0,0 +1,146 @@
+package wework
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRateLimit is the default number of calls per minute allowed to
+	// each endpoint. Wework limits every corp to 10000 calls per minute to a
+	// single api. Apis with lower limits are set with WithEndpointRateLimit.
+	DefaultRateLimit = 10000
+)
+
+// rateLimiter is a token bucket limiter keeping one bucket per endpoint.
+// Endpoints are allowed perMinute calls, unless limits sets their own.
+type rateLimiter struct {
+	mu        *sync.Mutex
+	perMinute int
+	limits    map[string]int
+	buckets   map[string]*bucket
+}
+
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter allowing perMinute calls per endpoint. A
+// non-positive perMinute disables limiting.
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{
+		mu:        &sync.Mutex{},
+		perMinute: perMinute,
+		limits:    make(map[string]int),
+		buckets:   make(map[string]*bucket),
+	}
+}
+
+// newBucket returns a full bucket allowing perMinute calls, in bursts of up
+// to 1% of that.
+func newBucket(perMinute int, now time.Time) *bucket {
+	burst := perMinute / 100
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &bucket{
+		rate:   float64(perMinute) / 60,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// apiPath returns the path of an api given with or without the /cgi-bin/
+// prefix.
+func apiPath(path string) string {
+	return "/cgi-bin/" + strings.TrimPrefix(strings.TrimPrefix(path, "/"), "cgi-bin/")
+}
+
+// wait blocks until a call to endpoint is allowed or ctx is done. The call
+// is given back if ctx is done first, so cancelled calls do not count.
+func (l *rateLimiter) wait(ctx context.Context, endpoint string) error {
+	delay := l.reserve(endpoint)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel(endpoint)
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token from the endpoint bucket and returns how long the
+// caller has to wait before it becomes available.
+func (l *rateLimiter) reserve(endpoint string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(endpoint)
+	if b == nil {
+		return 0
+	}
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel gives back a token reserved from the endpoint bucket.
+func (l *rateLimiter) cancel(endpoint string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b := l.bucket(endpoint); b != nil {
+		b.tokens = minFloat(b.tokens+1, b.burst)
+	}
+}
+
+// bucket returns the endpoint bucket refilled up to now, or nil if the
+// endpoint is not limited. l.mu must be held.
+func (l *rateLimiter) bucket(endpoint string) *bucket {
+	now := time.Now()
+
+	b, ok := l.buckets[endpoint]
+	if !ok {
+		perMinute, ok := l.limits[endpoint]
+		if !ok {
+			perMinute = l.perMinute
+		}
+
+		if perMinute <= 0 {
+			return nil
+		}
+
+		b = newBucket(perMinute, now)
+		l.buckets[endpoint] = b
+	}
+
+	b.tokens = minFloat(b.tokens+now.Sub(b.last).Seconds()*b.rate, b.burst)
+	b.last = now
+	return b
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
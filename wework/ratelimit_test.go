@@ -0,0 +1,109 @@
+package wework
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	tests := []struct {
+		name      string
+		perMinute int
+		calls     int
+		wantWait  bool
+	}{
+		{"within burst", 6000, 60, false},
+		{"burst exhausted", 6000, 61, true},
+		{"minimum burst", 60, 2, true},
+		{"disabled", 0, 1000, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(tt.perMinute)
+
+			var last time.Duration
+			for i := 0; i < tt.calls; i++ {
+				last = l.reserve("user/get")
+			}
+
+			if (last > 0) != tt.wantWait {
+				t.Errorf("wait after %d calls = %v, want wait %v", tt.calls, last, tt.wantWait)
+			}
+
+			if d := l.reserve("department/list"); tt.perMinute > 0 && d > 0 {
+				t.Errorf("wait of other endpoint = %v, want 0", d)
+			}
+		})
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	l := newRateLimiter(600)
+
+	for i := 0; i < 6; i++ {
+		if err := l.wait(context.Background(), "user/get"); err != nil {
+			t.Fatalf("wait error: %v", err)
+		}
+	}
+
+	start := time.Now()
+	if err := l.wait(context.Background(), "user/get"); err != nil {
+		t.Fatalf("wait error: %v", err)
+	}
+
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("wait after burst took %v, want about 100ms", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := l.wait(ctx, "user/get"); err != context.Canceled {
+		t.Errorf("wait with done context error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestRateLimiterEndpointLimits(t *testing.T) {
+	l := newRateLimiter(6000)
+	l.limits[apiPath("user/get")] = 60
+	l.limits[apiPath("/cgi-bin/message/send")] = 0
+
+	if d := l.reserve(getUserPath); d > 0 {
+		t.Fatalf("first wait of user/get = %v, want 0", d)
+	}
+
+	if d := l.reserve(getUserPath); d <= 0 {
+		t.Errorf("second wait of user/get = %v, want a wait under its own limit", d)
+	}
+
+	for i := 0; i < 100; i++ {
+		if d := l.reserve("/cgi-bin/message/send"); d > 0 {
+			t.Fatalf("wait of unlimited message/send = %v, want 0", d)
+		}
+	}
+
+	if d := l.reserve("/cgi-bin/department/list"); d > 0 {
+		t.Errorf("wait of department/list = %v, want 0 under the default limit", d)
+	}
+}
+
+func TestRateLimiterWaitGivesBackCancelled(t *testing.T) {
+	l := newRateLimiter(60)
+	l.reserve("user/get")
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		err := l.wait(ctx, "user/get")
+		cancel()
+
+		if err != context.DeadlineExceeded {
+			t.Fatalf("wait error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	}
+
+	if d := l.reserve("user/get"); d > time.Second {
+		t.Errorf("wait after cancelled calls = %v, want at most 1s", d)
+	}
+}
@@ -0,0 +1,181 @@
+package wework
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	DefaultReplicaInterval = 30 * time.Minute
+
+	replicaRetryInterval = time.Minute
+)
+
+// Replica mirrors the directory in memory, syncing it every interval. When
+// path is set, snapshots are saved there so a restarted replica serves the
+// last one right away.
+type Replica struct {
+	client   *Client
+	path     string
+	interval time.Duration
+
+	mu        *sync.RWMutex
+	snapshot  *Snapshot
+	listeners []func(*Diff)
+
+	trigger   chan struct{}
+	closed    chan struct{}
+	closeOnce *sync.Once
+}
+
+func NewReplica(c *Client, path string, interval time.Duration) *Replica {
+	if interval <= 0 {
+		interval = DefaultReplicaInterval
+	}
+
+	return &Replica{
+		client:    c,
+		path:      path,
+		interval:  interval,
+		mu:        &sync.RWMutex{},
+		trigger:   make(chan struct{}, 1),
+		closed:    make(chan struct{}),
+		closeOnce: &sync.Once{},
+	}
+}
+
+// Start loads the saved snapshot, if any, and syncs in the background until
+// Close.
+func (r *Replica) Start() {
+	if r.path != "" {
+		s, err := LoadSnapshot(r.path)
+		if err != nil {
+			glog.Warningf("Load directory snapshot failed. %v", err)
+		} else if s != nil {
+			glog.Infof("Directory snapshot of %v loaded", s.SyncedAt)
+			r.mu.Lock()
+			r.snapshot = s
+			r.mu.Unlock()
+		}
+	}
+
+	go r.syncLoop()
+}
+
+// OnChange registers f to be called with the changes found by every sync.
+// It must be called before Start.
+func (r *Replica) OnChange(f func(*Diff)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.listeners = append(r.listeners, f)
+}
+
+// Snapshot returns the latest snapshot, or nil if none was taken yet.
+func (r *Replica) Snapshot() *Snapshot {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.snapshot
+}
+
+// Fresh returns the latest snapshot if it is at most maxAge old, or nil.
+func (r *Replica) Fresh(maxAge time.Duration) *Snapshot {
+	s := r.Snapshot()
+	if s == nil || s.Age() > maxAge {
+		return nil
+	}
+
+	return s
+}
+
+// Trigger requests a sync ahead of schedule, e.g. on contact changes.
+func (r *Replica) Trigger() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Sync takes a new snapshot and returns the changes since the previous one.
+func (r *Replica) Sync(ctx context.Context) (*Diff, error) {
+	s, err := r.client.GetSnapshotContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	old := r.snapshot
+	r.snapshot = s
+	listeners := r.listeners
+	r.mu.Unlock()
+
+	if r.path != "" {
+		if err := SaveSnapshot(r.path, s); err != nil {
+			glog.Warningf("Save directory snapshot failed. %v", err)
+		}
+	}
+
+	d := DiffSnapshots(old, s)
+	if old != nil && !d.Empty() {
+		for _, f := range listeners {
+			f(d)
+		}
+	}
+
+	return d, nil
+}
+
+// Close stops syncing.
+func (r *Replica) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+	})
+
+	return nil
+}
+
+func (r *Replica) syncLoop() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-r.closed
+		cancel()
+	}()
+
+	wait := time.Duration(0)
+	if s := r.Snapshot(); s != nil && s.Age() < r.interval {
+		wait = r.interval - s.Age()
+	}
+
+	for {
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-r.closed:
+			timer.Stop()
+			return
+		case <-r.trigger:
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		start := time.Now()
+		d, err := r.Sync(ctx)
+		if err != nil {
+			glog.Errorf("Sync directory failed. %v", err)
+			wait = replicaRetryInterval
+			continue
+		}
+
+		s := r.Snapshot()
+		glog.Infof("Directory synced in %v. %d users, %d departments, %d tags. %d added, %d updated, %d removed users",
+			time.Since(start), len(s.Users), len(s.Departments), len(s.Tags),
+			len(d.AddedUsers), len(d.UpdatedUsers), len(d.RemovedUsers))
+		wait = r.interval
+	}
+}
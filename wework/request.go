@@ -2,104 +2,233 @@ package wework
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/golang/glog"
 )
 
 const (
 	ContentTypeJson string = "application/json"
+
+	accessTokenParam = "access_token"
 )
 
-func (c *Client) getJSON(url string, resp interface{}) error {
-	glog.V(4).Infof("Get %s", url)
+type baseResponse struct {
+	Code    int    `json:"errcode"`
+	Message string `json:"errmsg"`
+}
 
-	reqURL, err := c.urlWithToken(url)
-	if err != nil {
-		return err
-	}
+// getJSON sends a GET authenticated with the token of credential cred.
+func (c *Client) getJSON(ctx context.Context, cred Credential, path string, resp interface{}) error {
+	return c.getJSONWith(ctx, c.holder(cred), accessTokenParam, path, resp)
+}
 
-	httpResp, err := http.Get(reqURL)
-	if err != nil {
-		return fmt.Errorf("http.Get error: %v", err)
-	}
+// postJSON sends a POST authenticated with the token of credential cred.
+func (c *Client) postJSON(ctx context.Context, cred Credential, path string, req interface{}, resp interface{}) error {
+	return c.postJSONWith(ctx, c.holder(cred), accessTokenParam, path, req, resp)
+}
 
-	defer httpResp.Body.Close()
-	body, err := ioutil.ReadAll(httpResp.Body)
-	if err != nil {
-		return fmt.Errorf("http response read error: %v", err)
-	}
+// getJSONWith sends a GET authenticated with the token of h, passed in the
+// query parameter param.
+func (c *Client) getJSONWith(ctx context.Context, h *tokenHolder, param, path string, resp interface{}) error {
+	glog.V(4).Infof("Get %s", path)
 
-	glog.V(4).Infof("Response %d %s", httpResp.StatusCode, body)
+	return c.callWithToken(ctx, h, param, path, func(reqURL string) (*baseResponse, error) {
+		return c.doJSON(ctx, http.MethodGet, reqURL, nil, resp)
+	})
+}
 
-	if httpResp.StatusCode != http.StatusOK {
-		return fmt.Errorf("illegal http status code: %v", httpResp.StatusCode)
+// postJSONWith sends a POST authenticated with the token of h, passed in the
+// query parameter param.
+func (c *Client) postJSONWith(ctx context.Context, h *tokenHolder, param, path string, req interface{}, resp interface{}) error {
+	body, err := encodeBody(path, req)
+	if err != nil {
+		return err
 	}
 
-	if err := json.Unmarshal(body, resp); err != nil {
-		return fmt.Errorf("json.Unmarshal error: %v", err)
+	return c.callWithToken(ctx, h, param, path, func(reqURL string) (*baseResponse, error) {
+		return c.doJSON(ctx, http.MethodPost, reqURL, bytes.NewReader(body), resp)
+	})
+}
+
+// postJSONOnce sends a POST like postJSON, but does not retry it on
+// retryable errors. It is meant for apis with side effects, e.g. sending a
+// message, which may have taken place despite a 5xx or a busy errcode.
+func (c *Client) postJSONOnce(ctx context.Context, cred Credential, path string, req interface{}, resp interface{}) error {
+	body, err := encodeBody(path, req)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return c.callOnce(ctx, c.holder(cred), accessTokenParam, path, endpointOf(path), func(reqURL string) (*baseResponse, error) {
+		return c.doJSON(ctx, http.MethodPost, reqURL, bytes.NewReader(body), resp)
+	})
 }
 
-func (c *Client) postJSON(url string, req interface{}, resp interface{}) error {
+func encodeBody(path string, req interface{}) ([]byte, error) {
 	buf := new(bytes.Buffer)
 	encoder := json.NewEncoder(buf)
 	encoder.SetEscapeHTML(false)
 
 	if err := encoder.Encode(req); err != nil {
-		return fmt.Errorf("json.Encode error: %v", err)
+		return nil, fmt.Errorf("json.Encode error: %v", err)
 	}
 
-	reqURL, err := c.urlWithToken(url)
+	glog.V(4).Infof("Post %s Body: %s", path, buf.String())
+	return buf.Bytes(), nil
+}
+
+// callWithToken invokes call with the access token appended to path and
+// retries it on retryable errors. Calls must be idempotent, or be made with
+// callOnce instead.
+func (c *Client) callWithToken(ctx context.Context, h *tokenHolder, param, path string, call func(reqURL string) (*baseResponse, error)) error {
+	endpoint := endpointOf(path)
+
+	return c.withRetry(ctx, endpoint, func() error {
+		return c.callOnce(ctx, h, param, path, endpoint, call)
+	})
+}
+
+// callOnce invokes call with the access token appended to path. If the API
+// rejects the token, it is dropped and the call is replayed once with a
+// freshly fetched token, which is safe since the rejected call had no
+// effect. A non-zero errcode is returned as *APIError. Calls are rate
+// limited per endpoint.
+func (c *Client) callOnce(ctx context.Context, h *tokenHolder, param, path, endpoint string, call func(reqURL string) (*baseResponse, error)) error {
+	for retried := false; ; retried = true {
+		token, err := h.get(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := c.limiter.wait(ctx, endpoint); err != nil {
+			return err
+		}
+
+		reqURL, err := c.urlWithToken(path, param, token)
+		if err != nil {
+			return err
+		}
+
+		base, err := call(reqURL)
+		if err != nil {
+			return err
+		}
+
+		if base.Code == ErrCodeOK {
+			return nil
+		}
+
+		if !isTokenError(base.Code) || retried {
+			return newAPIError(endpoint, base.Code, base.Message)
+		}
+
+		glog.Warningf("Access token rejected with errcode %d. Refreshing", base.Code)
+		h.invalidate(token)
+	}
+}
+
+// doJSON sends the request and decodes the response body into resp. The
+// errcode and errmsg carried by the response are returned alongside.
+func (c *Client) doJSON(ctx context.Context, method, reqURL string, body io.Reader, resp interface{}) (*baseResponse, error) {
+	httpReq, err := http.NewRequest(method, reqURL, body)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("http.NewRequest error: %v", err)
 	}
 
-	glog.V(4).Infof("Post %s Body: %s", url, buf.String())
+	if body != nil {
+		httpReq.Header.Set("Content-Type", ContentTypeJson)
+	}
 
-	httpResp, err := http.Post(reqURL, ContentTypeJson, buf)
+	httpResp, err := c.httpClient.Do(httpReq.WithContext(ctx))
 	if err != nil {
-		return fmt.Errorf("http.Post error: %v", err)
+		return nil, fmt.Errorf("http.Do error: %v", err)
 	}
 
 	defer httpResp.Body.Close()
-	body, err := ioutil.ReadAll(httpResp.Body)
+	respBody, err := ioutil.ReadAll(httpResp.Body)
 	if err != nil {
-		return fmt.Errorf("http response read error: %v", err)
+		return nil, fmt.Errorf("http response read error: %v", err)
 	}
 
-	glog.V(4).Infof("Response %d %s", httpResp.StatusCode, body)
+	glog.V(4).Infof("Response %d %s", httpResp.StatusCode, respBody)
 
 	if httpResp.StatusCode != http.StatusOK {
-		return fmt.Errorf("illegal http status code: %v", httpResp.StatusCode)
+		return nil, &StatusError{StatusCode: httpResp.StatusCode}
 	}
 
-	if err := json.Unmarshal(body, resp); err != nil {
-		return fmt.Errorf("json.Unmarshal error: %v", err)
+	var base baseResponse
+	if err := json.Unmarshal(respBody, &base); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal error: %v", err)
 	}
 
-	return nil
+	if err := json.Unmarshal(respBody, resp); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal error: %v", err)
+	}
+
+	return &base, nil
+}
+
+func endpointOf(path string) string {
+	if i := strings.Index(path, "?"); i >= 0 {
+		return path[:i]
+	}
+
+	return path
 }
 
-func (c *Client) urlWithToken(s string) (string, error) {
-	u, err := url.Parse(s)
+func (c *Client) apiURL(path string) (*url.URL, error) {
+	u, err := url.Parse(c.baseURL + path)
 	if err != nil {
-		return "", fmt.Errorf("illegal url: %v", err)
+		return nil, fmt.Errorf("illegal url: %v", err)
 	}
 
-	token, err := c.refreshAccessToken()
+	return u, nil
+}
+
+// postJSONNoToken sends a POST that needs no token, e.g. to obtain one.
+func (c *Client) postJSONNoToken(ctx context.Context, path string, req interface{}, resp interface{}) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("json.Marshal error: %v", err)
+	}
+
+	u, err := c.apiURL(path)
+	if err != nil {
+		return err
+	}
+
+	if err := c.limiter.wait(ctx, path); err != nil {
+		return err
+	}
+
+	base, err := c.doJSON(ctx, http.MethodPost, u.String(), bytes.NewReader(data), resp)
+	if err != nil {
+		return err
+	}
+
+	if base.Code != ErrCodeOK {
+		return newAPIError(path, base.Code, base.Message)
+	}
+
+	return nil
+}
+
+func (c *Client) urlWithToken(path, param, token string) (string, error) {
+	u, err := c.apiURL(path)
 	if err != nil {
-		return "", fmt.Errorf("get access token error: %v", err)
+		return "", err
 	}
 
 	q := u.Query()
-	q.Set("access_token", token)
+	q.Set(param, token)
 
 	u.RawQuery = q.Encode()
 	return u.String(), nil
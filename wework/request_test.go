@@ -0,0 +1,73 @@
+package wework_test
+
+import (
+	"testing"
+
+	"github.com/pragkent/hydra-wework/wework"
+	"github.com/pragkent/hydra-wework/wework/weworktest"
+)
+
+func TestTokenRejectedReplay(t *testing.T) {
+	tests := []struct {
+		name       string
+		reject     func(s *weworktest.Server)
+		wantCode   int
+		wantTokens int
+		wantCalls  int
+	}{
+		{
+			name:       "expired",
+			reject:     (*weworktest.Server).ExpireTokens,
+			wantTokens: 2,
+			wantCalls:  3,
+		},
+		{
+			name:       "revoked",
+			reject:     (*weworktest.Server).RevokeTokens,
+			wantTokens: 2,
+			wantCalls:  3,
+		},
+		{
+			name:       "rejected twice",
+			reject:     func(s *weworktest.Server) { s.FailNext("/cgi-bin/user/get", wework.ErrCodeInvalidToken, 2) },
+			wantCode:   wework.ErrCodeInvalidToken,
+			wantTokens: 2,
+			wantCalls:  3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := weworktest.NewServer()
+			defer srv.Close()
+
+			srv.AddUser(wework.User{UserID: "zhangsan", Name: "张三", Department: []int{1}})
+
+			c := srv.Client()
+			defer c.Close()
+
+			if _, err := c.GetUser("zhangsan"); err != nil {
+				t.Fatalf("GetUser error: %v", err)
+			}
+
+			tt.reject(srv)
+
+			_, err := c.GetUser("zhangsan")
+			if code := wework.ErrorCode(err); code != tt.wantCode {
+				t.Fatalf("GetUser errcode = %d, want %d. err: %v", code, tt.wantCode, err)
+			}
+
+			if tt.wantCode == wework.ErrCodeOK && err != nil {
+				t.Fatalf("GetUser error: %v", err)
+			}
+
+			if n := srv.Calls("/cgi-bin/gettoken"); n != tt.wantTokens {
+				t.Errorf("gettoken calls = %d, want %d", n, tt.wantTokens)
+			}
+
+			if n := srv.Calls("/cgi-bin/user/get"); n != tt.wantCalls {
+				t.Errorf("user/get calls = %d, want %d", n, tt.wantCalls)
+			}
+		})
+	}
+}
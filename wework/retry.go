@@ -0,0 +1,66 @@
+package wework
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// RetryPolicy controls how calls failing with a retryable error are retried.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+
+	// BaseDelay is the backoff before the first retry. It doubles with
+	// every further retry up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 2,
+	BaseDelay:  200 * time.Millisecond,
+	MaxDelay:   2 * time.Second,
+}
+
+// backoff returns the delay before the given retry, with full jitter.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.BaseDelay
+	for i := 0; i < retry && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+// withRetry invokes call until it succeeds, fails with an error that is not
+// retryable, or the retries are exhausted.
+func (c *Client) withRetry(ctx context.Context, endpoint string, call func() error) error {
+	for retry := 0; ; retry++ {
+		err := call()
+		if err == nil || retry >= c.retryPolicy.MaxRetries || !IsRetryable(err) {
+			return err
+		}
+
+		delay := c.retryPolicy.backoff(retry)
+		glog.Warningf("Call %s failed. Retrying in %v. %v", endpoint, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
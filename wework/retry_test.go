@@ -0,0 +1,135 @@
+package wework_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pragkent/hydra-wework/wework"
+	"github.com/pragkent/hydra-wework/wework/weworktest"
+)
+
+var testRetryPolicy = wework.RetryPolicy{
+	MaxRetries: 2,
+	BaseDelay:  time.Millisecond,
+	MaxDelay:   5 * time.Millisecond,
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		fault     weworktest.Fault
+		wantCode  int
+		wantErr   bool
+		wantCalls int
+	}{
+		{
+			name:      "system busy",
+			fault:     weworktest.Fault{Code: wework.ErrCodeSystemBusy, Times: 2},
+			wantCalls: 3,
+		},
+		{
+			name:      "frequency limit",
+			fault:     weworktest.Fault{Code: wework.ErrCodeFrequencyLimit, Times: 1},
+			wantCalls: 2,
+		},
+		{
+			name:      "server error",
+			fault:     weworktest.Fault{StatusCode: http.StatusBadGateway, Times: 1},
+			wantCalls: 2,
+		},
+		{
+			name:      "retries exhausted",
+			fault:     weworktest.Fault{Code: wework.ErrCodeFrequencyLimit, Times: 3},
+			wantCode:  wework.ErrCodeFrequencyLimit,
+			wantErr:   true,
+			wantCalls: 3,
+		},
+		{
+			name:      "not retryable",
+			fault:     weworktest.Fault{Code: wework.ErrCodeInvalidParameter, Times: 1},
+			wantCode:  wework.ErrCodeInvalidParameter,
+			wantErr:   true,
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := weworktest.NewServer()
+			defer srv.Close()
+
+			srv.AddUser(wework.User{UserID: "zhangsan", Name: "张三", Department: []int{1}})
+
+			c := srv.Client(wework.WithRetryPolicy(testRetryPolicy))
+			defer c.Close()
+
+			srv.Inject("/cgi-bin/user/get", tt.fault)
+
+			_, err := c.GetUser("zhangsan")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetUser error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if code := wework.ErrorCode(err); code != tt.wantCode {
+				t.Errorf("GetUser errcode = %d, want %d", code, tt.wantCode)
+			}
+
+			if n := srv.Calls("/cgi-bin/user/get"); n != tt.wantCalls {
+				t.Errorf("user/get calls = %d, want %d", n, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestSendMessageNotRetried(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault weworktest.Fault
+	}{
+		{"system busy", weworktest.Fault{Code: wework.ErrCodeSystemBusy, Times: 1}},
+		{"server error", weworktest.Fault{StatusCode: http.StatusBadGateway, Times: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := weworktest.NewServer()
+			defer srv.Close()
+
+			c := srv.Client(wework.WithRetryPolicy(testRetryPolicy))
+			defer c.Close()
+
+			srv.Inject("/cgi-bin/message/send", tt.fault)
+
+			if _, err := c.SendMessage(wework.NewTextMessage("hello", "zhangsan")); !wework.IsRetryable(err) {
+				t.Fatalf("SendMessage error = %v, want a retryable error", err)
+			}
+
+			if n := srv.Calls("/cgi-bin/message/send"); n != 1 {
+				t.Errorf("message/send calls = %d, want 1", n)
+			}
+		})
+	}
+}
+
+func TestSendMessageReplaysRejectedToken(t *testing.T) {
+	srv := weworktest.NewServer()
+	defer srv.Close()
+
+	c := srv.Client()
+	defer c.Close()
+
+	if _, err := c.SendMessage(wework.NewTextMessage("hello", "zhangsan")); err != nil {
+		t.Fatalf("SendMessage error: %v", err)
+	}
+
+	srv.ExpireTokens()
+
+	if _, err := c.SendMessage(wework.NewTextMessage("hello", "zhangsan")); err != nil {
+		t.Fatalf("SendMessage error: %v", err)
+	}
+
+	if n := len(srv.Messages()); n != 2 {
+		t.Errorf("messages sent = %d, want 2", n)
+	}
+}
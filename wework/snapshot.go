@@ -0,0 +1,287 @@
+package wework
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pragkent/hydra-wework/internal/fsutil"
+)
+
+// Snapshot is a copy of the directory visible to the client: departments,
+// tags with their members, members with their full profile, and the agent
+// of the client, if any.
+type Snapshot struct {
+	SyncedAt    time.Time                      `json:"synced_at"`
+	Departments []Department                   `json:"departments"`
+	Tags        []Tag                          `json:"tags"`
+	TagMembers  map[int]*GetTagMembersResponse `json:"tag_members"`
+	Users       []User                         `json:"users"`
+	Agent       *Agent                         `json:"agent,omitempty"`
+
+	once  *sync.Once
+	users map[string]*User
+	tree  *DepartmentTree
+	index *TagIndex
+	vr    *VisibleRange
+}
+
+// User returns the member uid, or nil if it is not in the snapshot.
+func (s *Snapshot) User(uid string) *User {
+	s.build()
+	return s.users[uid]
+}
+
+// DepartmentTree returns the departments linked into a tree.
+func (s *Snapshot) DepartmentTree() *DepartmentTree {
+	s.build()
+	return s.tree
+}
+
+// TagIndex returns the tags indexed for reverse lookups.
+func (s *Snapshot) TagIndex() *TagIndex {
+	s.build()
+	return s.index
+}
+
+// VisibleRange returns the visible range of the agent, or nil if the
+// snapshot has no agent.
+func (s *Snapshot) VisibleRange() *VisibleRange {
+	s.build()
+	return s.vr
+}
+
+// Age returns how long ago the snapshot was taken.
+func (s *Snapshot) Age() time.Duration {
+	return time.Since(s.SyncedAt)
+}
+
+func (s *Snapshot) build() {
+	s.once.Do(func() {
+		s.users = make(map[string]*User, len(s.Users))
+		for i := range s.Users {
+			s.users[s.Users[i].UserID] = &s.Users[i]
+		}
+
+		s.tree = NewDepartmentTree(s.Departments)
+		s.index = NewTagIndex(s.Tags, s.TagMembers, s.tree)
+
+		if s.Agent != nil {
+			s.vr = NewVisibleRange(s.Agent, s.index)
+		}
+	})
+}
+
+func newSnapshot() *Snapshot {
+	return &Snapshot{
+		TagMembers: make(map[int]*GetTagMembersResponse),
+		once:       &sync.Once{},
+	}
+}
+
+// GetSnapshot copies the directory with the list apis.
+func (c *Client) GetSnapshot() (*Snapshot, error) {
+	return c.GetSnapshotContext(context.Background())
+}
+
+func (c *Client) GetSnapshotContext(ctx context.Context) (*Snapshot, error) {
+	s := newSnapshot()
+	s.SyncedAt = time.Now()
+
+	depts, err := c.ListDepartmentsContext(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Departments = depts
+
+	seen := make(map[string]bool)
+	for _, root := range NewDepartmentTree(depts).Roots {
+		users, err := c.ListUsersByDepartmentContext(ctx, root.ID, true, true).All()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, u := range users {
+			if !seen[u.UserID] {
+				seen[u.UserID] = true
+				s.Users = append(s.Users, u)
+			}
+		}
+	}
+
+	sort.Slice(s.Users, func(i, j int) bool { return s.Users[i].UserID < s.Users[j].UserID })
+
+	tags, err := c.ListTagsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Tags = tags
+	for _, t := range tags {
+		m, err := c.GetTagMembersContext(ctx, t.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		s.TagMembers[t.ID] = m
+	}
+
+	if c.agentID != "" {
+		agent, err := c.GetAgentContext(ctx, c.agentID)
+		if err != nil {
+			return nil, err
+		}
+
+		s.Agent = &agent.Agent
+	}
+
+	return s, nil
+}
+
+// LoadSnapshot reads a snapshot saved by SaveSnapshot. It returns nil and
+// no error if path does not exist.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot file error: %v", err)
+	}
+
+	s := newSnapshot()
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal error: %v", err)
+	}
+
+	return s, nil
+}
+
+// SaveSnapshot writes s to path atomically.
+func SaveSnapshot(path string, s *Snapshot) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("json.Marshal error: %v", err)
+	}
+
+	if err := fsutil.WriteFileAtomic(path, data); err != nil {
+		return fmt.Errorf("write snapshot file error: %v", err)
+	}
+
+	return nil
+}
+
+// Diff lists what changed between two snapshots.
+type Diff struct {
+	AddedUsers   []string `json:"added_users,omitempty"`
+	UpdatedUsers []string `json:"updated_users,omitempty"`
+	RemovedUsers []string `json:"removed_users,omitempty"`
+
+	AddedDepartments   []int `json:"added_departments,omitempty"`
+	UpdatedDepartments []int `json:"updated_departments,omitempty"`
+	RemovedDepartments []int `json:"removed_departments,omitempty"`
+
+	AddedTags   []int `json:"added_tags,omitempty"`
+	UpdatedTags []int `json:"updated_tags,omitempty"`
+	RemovedTags []int `json:"removed_tags,omitempty"`
+}
+
+// Empty reports whether nothing changed.
+func (d *Diff) Empty() bool {
+	return reflect.DeepEqual(d, &Diff{})
+}
+
+// DiffSnapshots returns the changes from old to s. old may be nil, in which
+// case everything is added. A tag is updated when its name or members
+// change.
+func DiffSnapshots(old, s *Snapshot) *Diff {
+	if old == nil {
+		old = newSnapshot()
+	}
+
+	d := &Diff{}
+
+	oldUsers := make(map[string]User, len(old.Users))
+	for _, u := range old.Users {
+		oldUsers[u.UserID] = u
+	}
+
+	for _, u := range s.Users {
+		o, ok := oldUsers[u.UserID]
+		switch {
+		case !ok:
+			d.AddedUsers = append(d.AddedUsers, u.UserID)
+		case !reflect.DeepEqual(o, u):
+			d.UpdatedUsers = append(d.UpdatedUsers, u.UserID)
+		}
+
+		delete(oldUsers, u.UserID)
+	}
+
+	for uid := range oldUsers {
+		d.RemovedUsers = append(d.RemovedUsers, uid)
+	}
+
+	oldDepts := make(map[int]Department, len(old.Departments))
+	for _, dept := range old.Departments {
+		oldDepts[dept.ID] = dept
+	}
+
+	for _, dept := range s.Departments {
+		o, ok := oldDepts[dept.ID]
+		switch {
+		case !ok:
+			d.AddedDepartments = append(d.AddedDepartments, dept.ID)
+		case !reflect.DeepEqual(o, dept):
+			d.UpdatedDepartments = append(d.UpdatedDepartments, dept.ID)
+		}
+
+		delete(oldDepts, dept.ID)
+	}
+
+	for id := range oldDepts {
+		d.RemovedDepartments = append(d.RemovedDepartments, id)
+	}
+
+	oldTags := make(map[int]Tag, len(old.Tags))
+	for _, t := range old.Tags {
+		oldTags[t.ID] = t
+	}
+
+	for _, t := range s.Tags {
+		o, ok := oldTags[t.ID]
+		switch {
+		case !ok:
+			d.AddedTags = append(d.AddedTags, t.ID)
+		case o != t || !sameTagMembers(old.TagMembers[t.ID], s.TagMembers[t.ID]):
+			d.UpdatedTags = append(d.UpdatedTags, t.ID)
+		}
+
+		delete(oldTags, t.ID)
+	}
+
+	for id := range oldTags {
+		d.RemovedTags = append(d.RemovedTags, id)
+	}
+
+	sort.Strings(d.RemovedUsers)
+	sort.Ints(d.RemovedDepartments)
+	sort.Ints(d.RemovedTags)
+	return d
+}
+
+func sameTagMembers(a, b *GetTagMembersResponse) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return reflect.DeepEqual(a.Users, b.Users) && reflect.DeepEqual(a.Departments, b.Departments)
+}
@@ -0,0 +1,165 @@
+package wework_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/pragkent/hydra-wework/wework"
+	"github.com/pragkent/hydra-wework/wework/weworktest"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	base := &wework.Snapshot{
+		Departments: []wework.Department{{ID: 1, Name: "Corp"}, {ID: 2, Name: "Engineering", ParentID: 1}},
+		Tags:        []wework.Tag{{ID: 1, Name: "admins"}, {ID: 2, Name: "oncall"}},
+		TagMembers: map[int]*wework.GetTagMembersResponse{
+			1: {Users: []wework.TagUser{{UserID: "a"}}},
+			2: {Departments: []int{2}},
+		},
+		Users: []wework.User{
+			{UserID: "a", Name: "A", Department: []int{1}},
+			{UserID: "b", Name: "B", Department: []int{2}},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		old    *wework.Snapshot
+		change func(s *wework.Snapshot)
+		want   wework.Diff
+	}{
+		{
+			name:   "unchanged",
+			old:    base,
+			change: func(s *wework.Snapshot) {},
+		},
+		{
+			name:   "first sync",
+			change: func(s *wework.Snapshot) {},
+			want: wework.Diff{
+				AddedUsers:       []string{"a", "b"},
+				AddedDepartments: []int{1, 2},
+				AddedTags:        []int{1, 2},
+			},
+		},
+		{
+			name: "users",
+			old:  base,
+			change: func(s *wework.Snapshot) {
+				s.Users = []wework.User{
+					{UserID: "b", Name: "B", Department: []int{1}},
+					{UserID: "c", Name: "C", Department: []int{2}},
+				}
+			},
+			want: wework.Diff{
+				AddedUsers:   []string{"c"},
+				UpdatedUsers: []string{"b"},
+				RemovedUsers: []string{"a"},
+			},
+		},
+		{
+			name: "departments",
+			old:  base,
+			change: func(s *wework.Snapshot) {
+				s.Departments = []wework.Department{{ID: 1, Name: "Corporation"}, {ID: 3, Name: "Sales", ParentID: 1}}
+			},
+			want: wework.Diff{
+				AddedDepartments:   []int{3},
+				UpdatedDepartments: []int{1},
+				RemovedDepartments: []int{2},
+			},
+		},
+		{
+			name: "tag members",
+			old:  base,
+			change: func(s *wework.Snapshot) {
+				s.TagMembers = map[int]*wework.GetTagMembersResponse{
+					1: {Users: []wework.TagUser{{UserID: "a"}, {UserID: "b"}}},
+					2: {Departments: []int{2}},
+				}
+			},
+			want: wework.Diff{UpdatedTags: []int{1}},
+		},
+		{
+			name: "tags",
+			old:  base,
+			change: func(s *wework.Snapshot) {
+				s.Tags = []wework.Tag{{ID: 2, Name: "on-call"}, {ID: 3, Name: "new"}}
+			},
+			want: wework.Diff{
+				AddedTags:   []int{3},
+				UpdatedTags: []int{2},
+				RemovedTags: []int{1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := *base
+			tt.change(&s)
+
+			got := wework.DiffSnapshots(tt.old, &s)
+			sort.Strings(got.AddedUsers)
+
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("DiffSnapshots = %+v, want %+v", *got, tt.want)
+			}
+
+			if want := reflect.DeepEqual(tt.want, wework.Diff{}); got.Empty() != want {
+				t.Errorf("Empty = %v, want %v", got.Empty(), want)
+			}
+		})
+	}
+}
+
+func TestSnapshotVisibleRange(t *testing.T) {
+	srv := weworktest.NewServer()
+	defer srv.Close()
+
+	srv.AddDepartment(wework.Department{ID: 2, Name: "Engineering", ParentID: 1})
+	srv.AddDepartment(wework.Department{ID: 3, Name: "Platform", ParentID: 2})
+	srv.AddDepartment(wework.Department{ID: 4, Name: "Sales", ParentID: 1})
+	srv.AddUser(wework.User{UserID: "eng", Department: []int{3}})
+	srv.AddUser(wework.User{UserID: "sales", Department: []int{4}})
+	srv.AddUser(wework.User{UserID: "tagged", Department: []int{4}})
+	srv.AddUser(wework.User{UserID: "listed", Department: []int{4}})
+	srv.AddTag(wework.Tag{ID: 1, Name: "beta"}, []string{"tagged"}, nil)
+	srv.SetAgent(wework.Agent{
+		AgentID:          1000001,
+		AllowUsers:       wework.AgentAllowUsers{Users: []wework.AgentUser{{UserID: "listed"}}},
+		AllowDepartments: wework.AgentAllowPartys{IDs: []int{2}},
+		AllowTags:        wework.AgentAllowTags{IDs: []int{1}},
+	})
+
+	c := srv.Client()
+	defer c.Close()
+
+	s, err := c.GetSnapshot()
+	if err != nil {
+		t.Fatalf("GetSnapshot error: %v", err)
+	}
+
+	vr := s.VisibleRange()
+	if vr == nil {
+		t.Fatal("VisibleRange = nil, want the range of the agent")
+	}
+
+	tests := []struct {
+		uid  string
+		want bool
+	}{
+		{"eng", true},
+		{"sales", false},
+		{"tagged", true},
+		{"listed", true},
+	}
+
+	for _, tt := range tests {
+		u := s.User(tt.uid)
+		if got := vr.Contains(u.UserID, u.Department); got != tt.want {
+			t.Errorf("Contains(%v) = %v, want %v", tt.uid, got, tt.want)
+		}
+	}
+}
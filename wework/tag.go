@@ -0,0 +1,179 @@
+package wework
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+const (
+	listTagsPath      = "/cgi-bin/tag/list"
+	getTagMembersPath = "/cgi-bin/tag/get"
+)
+
+type Tag struct {
+	ID   int    `json:"tagid"`
+	Name string `json:"tagname"`
+}
+
+type ListTagsResponse struct {
+	Code    int    `json:"errcode,omitempty"`
+	Message string `json:"errmsg,omitempty"`
+	Tags    []Tag  `json:"taglist,omitempty"`
+}
+
+type TagUser struct {
+	UserID string `json:"userid"`
+	Name   string `json:"name,omitempty"`
+}
+
+type GetTagMembersResponse struct {
+	Code        int       `json:"errcode,omitempty"`
+	Message     string    `json:"errmsg,omitempty"`
+	TagName     string    `json:"tagname,omitempty"`
+	Users       []TagUser `json:"userlist,omitempty"`
+	Departments []int     `json:"partylist,omitempty"`
+}
+
+func (c *Client) ListTags() ([]Tag, error) {
+	return c.ListTagsContext(context.Background())
+}
+
+func (c *Client) ListTagsContext(ctx context.Context) ([]Tag, error) {
+	var resp ListTagsResponse
+	if err := c.getJSON(ctx, CredentialContacts, listTagsPath, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Tags, nil
+}
+
+// GetTagMembers returns the users and departments tagged with tagID.
+func (c *Client) GetTagMembers(tagID int) (*GetTagMembersResponse, error) {
+	return c.GetTagMembersContext(context.Background(), tagID)
+}
+
+func (c *Client) GetTagMembersContext(ctx context.Context, tagID int) (*GetTagMembersResponse, error) {
+	q := url.Values{}
+	q.Set("tagid", strconv.Itoa(tagID))
+
+	u := getTagMembersPath + "?" + q.Encode()
+
+	var resp GetTagMembersResponse
+	if err := c.getJSON(ctx, CredentialContacts, u, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// TagIndex answers which tags apply to a user. A user is tagged either
+// directly or through one of its departments or their ancestors.
+type TagIndex struct {
+	tags     []Tag
+	userTags map[string][]int
+	deptTags map[int][]int
+	deptTree *DepartmentTree
+	tagsByID map[int]Tag
+}
+
+// NewTagIndex builds an index from the tags, their members keyed by tag id
+// and the department tree used to resolve tagged parent departments. tree
+// may be nil, in which case only the user's own departments are considered.
+func NewTagIndex(tags []Tag, members map[int]*GetTagMembersResponse, tree *DepartmentTree) *TagIndex {
+	idx := &TagIndex{
+		tags:     tags,
+		userTags: make(map[string][]int),
+		deptTags: make(map[int][]int),
+		deptTree: tree,
+		tagsByID: make(map[int]Tag, len(tags)),
+	}
+
+	for _, t := range tags {
+		idx.tagsByID[t.ID] = t
+
+		m := members[t.ID]
+		if m == nil {
+			continue
+		}
+
+		for _, u := range m.Users {
+			idx.userTags[u.UserID] = append(idx.userTags[u.UserID], t.ID)
+		}
+
+		for _, d := range m.Departments {
+			idx.deptTags[d] = append(idx.deptTags[d], t.ID)
+		}
+	}
+
+	return idx
+}
+
+// Tags returns all indexed tags.
+func (idx *TagIndex) Tags() []Tag {
+	return idx.tags
+}
+
+// TagsForUser returns the tags applying to uid, a member of deptIDs.
+func (idx *TagIndex) TagsForUser(uid string, deptIDs []int) []Tag {
+	seen := make(map[int]bool)
+	var tags []Tag
+
+	add := func(ids []int) {
+		for _, id := range ids {
+			if seen[id] {
+				continue
+			}
+
+			seen[id] = true
+			tags = append(tags, idx.tagsByID[id])
+		}
+	}
+
+	add(idx.userTags[uid])
+	for _, d := range deptIDs {
+		add(idx.deptTags[d])
+
+		if idx.deptTree == nil {
+			continue
+		}
+
+		if n := idx.deptTree.Get(d); n != nil {
+			for _, a := range n.Ancestors() {
+				add(idx.deptTags[a])
+			}
+		}
+	}
+
+	return tags
+}
+
+// GetTagIndex fetches all tags with their members and the department tree,
+// and indexes them for reverse lookups.
+func (c *Client) GetTagIndex() (*TagIndex, error) {
+	return c.GetTagIndexContext(context.Background())
+}
+
+func (c *Client) GetTagIndexContext(ctx context.Context) (*TagIndex, error) {
+	tags, err := c.ListTagsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make(map[int]*GetTagMembersResponse, len(tags))
+	for _, t := range tags {
+		m, err := c.GetTagMembersContext(ctx, t.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		members[t.ID] = m
+	}
+
+	tree, err := c.GetDepartmentTreeContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTagIndex(tags, members, tree), nil
+}
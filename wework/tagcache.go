@@ -0,0 +1,52 @@
+package wework
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	DefaultTagCacheTTL = 5 * time.Minute
+)
+
+// TagCache keeps a TagIndex for ttl so reverse lookups do not hit the api.
+type TagCache struct {
+	index *cachedValue
+}
+
+func NewTagCache(c *Client, ttl time.Duration) *TagCache {
+	if ttl <= 0 {
+		ttl = DefaultTagCacheTTL
+	}
+
+	return &TagCache{
+		index: newCachedValue(ttl, func(ctx context.Context) (interface{}, error) {
+			return c.GetTagIndexContext(ctx)
+		}),
+	}
+}
+
+// Index returns the cached index, reloading it if it is older than ttl.
+func (tc *TagCache) Index(ctx context.Context) (*TagIndex, error) {
+	v, err := tc.index.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*TagIndex), nil
+}
+
+// TagsForUser returns the tags applying to uid, a member of deptIDs.
+func (tc *TagCache) TagsForUser(ctx context.Context, uid string, deptIDs []int) ([]Tag, error) {
+	idx, err := tc.Index(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return idx.TagsForUser(uid, deptIDs), nil
+}
+
+// Invalidate drops the cached index so the next lookup reloads it.
+func (tc *TagCache) Invalidate() {
+	tc.index.invalidate()
+}
@@ -1,12 +1,33 @@
 package wework
 
 import (
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
+	"context"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	getTokenPath = "/cgi-bin/gettoken"
+
+	DefaultTokenRefreshRatio = 0.8
+
+	tokenRetryInterval = 10 * time.Second
+
+	// defaultTokenTTL is the lifetime assumed for tokens fetched without
+	// expires_in, so that they are not refetched in a tight loop.
+	defaultTokenTTL = 7200 * time.Second
+
+	// tokenFetchTimeout bounds a fetch, so a hung store or api does not
+	// hold up every reader of the token.
+	tokenFetchTimeout = time.Minute
+
+	// tokenLockTimeout is how long a fetch waits for the store lock held by
+	// another client before fetching regardless.
+	tokenLockTimeout = 10 * time.Second
 )
 
 type GetAccessTokenResponse struct {
@@ -16,58 +37,305 @@ type GetAccessTokenResponse struct {
 	ExpiresIn   int    `json:"expires_in,omitempty"`
 }
 
-func (c *Client) refreshAccessToken() (string, error) {
-	c.tokenHolder.mu.Lock()
-	defer c.tokenHolder.mu.Unlock()
+// AccessToken returns a valid access token, fetching a new one if needed.
+func (c *Client) AccessToken() (string, error) {
+	return c.AccessTokenContext(context.Background())
+}
 
-	now := time.Now()
-	if now.Before(c.tokenHolder.expiresAt) {
-		return c.tokenHolder.token, nil
-	}
+func (c *Client) AccessTokenContext(ctx context.Context) (string, error) {
+	return c.refreshAccessToken(ctx)
+}
 
-	resp, err := c.requestAccessToken()
-	if err != nil {
-		return "", err
-	}
+func (c *Client) refreshAccessToken(ctx context.Context) (string, error) {
+	return c.tokenHolder.get(ctx)
+}
 
-	c.tokenHolder.token = resp.AccessToken
-	c.tokenHolder.expiresAt = now.Add(time.Duration(resp.ExpiresIn) * time.Second)
+// fetchAccessToken returns a fetcher of access tokens of secret.
+func (c *Client) fetchAccessToken(secret string) tokenFetcher {
+	return func(ctx context.Context) (string, time.Duration, error) {
+		resp, err := c.requestAccessToken(ctx, secret)
+		if err != nil {
+			return "", 0, err
+		}
 
-	return c.tokenHolder.token, err
+		return resp.AccessToken, time.Duration(resp.ExpiresIn) * time.Second, nil
+	}
 }
 
-func (c *Client) requestAccessToken() (*GetAccessTokenResponse, error) {
+func (c *Client) requestAccessToken(ctx context.Context, secret string) (*GetAccessTokenResponse, error) {
 	q := url.Values{}
 	q.Set("corpid", c.corpID)
-	q.Set("corpsecret", c.agentSecret)
+	q.Set("corpsecret", secret)
+
+	u, err := c.apiURL(getTokenPath)
+	if err != nil {
+		return nil, err
+	}
 
-	u, _ := url.Parse("https://qyapi.weixin.qq.com/cgi-bin/gettoken")
 	u.RawQuery = q.Encode()
 
-	httpResp, err := http.Get(u.String())
+	if err := c.limiter.wait(ctx, getTokenPath); err != nil {
+		return nil, err
+	}
+
+	var resp GetAccessTokenResponse
+	if _, err := c.doJSON(ctx, http.MethodGet, u.String(), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	if resp.Code != ErrCodeOK {
+		return nil, newAPIError(getTokenPath, resp.Code, resp.Message)
+	}
+
+	return &resp, nil
+}
+
+type tokenFetcher func(ctx context.Context) (string, time.Duration, error)
+
+// tokenHolder caches an access token and renews it in the background once
+// refreshRatio of its lifetime has passed. Concurrent fetches are collapsed
+// into one, and readers only wait on the network when no valid token exists.
+// Tokens are shared through store, so a token obtained by another client is
+// reused until it is due for renewal.
+type tokenHolder struct {
+	mu           *sync.Mutex
+	key          string
+	store        TokenStore
+	fetch        tokenFetcher
+	refreshRatio float64
+	token        string
+	expiresAt    time.Time
+	refreshAt    time.Time
+	rejected     string
+	inflight     *tokenCall
+	updated      chan struct{}
+	closed       chan struct{}
+	closeOnce    *sync.Once
+}
+
+type tokenCall struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+func newTokenHolder(key string, store TokenStore, fetch tokenFetcher, refreshRatio float64) *tokenHolder {
+	if refreshRatio <= 0 || refreshRatio > 1 {
+		refreshRatio = DefaultTokenRefreshRatio
+	}
+
+	h := &tokenHolder{
+		mu:           &sync.Mutex{},
+		key:          key,
+		store:        store,
+		fetch:        fetch,
+		refreshRatio: refreshRatio,
+		updated:      make(chan struct{}, 1),
+		closed:       make(chan struct{}),
+		closeOnce:    &sync.Once{},
+	}
+
+	go h.refreshLoop()
+	return h
+}
+
+func (h *tokenHolder) get(ctx context.Context) (string, error) {
+	h.mu.Lock()
+
+	now := time.Now()
+	if h.token != "" && now.Before(h.expiresAt) {
+		token := h.token
+		if !now.Before(h.refreshAt) {
+			h.startFetchLocked()
+		}
+
+		h.mu.Unlock()
+		return token, nil
+	}
+
+	call := h.startFetchLocked()
+	h.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.token, call.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (h *tokenHolder) invalidate(token string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.rejected = token
+	if h.token == token {
+		h.token = ""
+		h.expiresAt = time.Time{}
+		h.refreshAt = time.Time{}
+	}
+}
+
+func (h *tokenHolder) close() {
+	h.closeOnce.Do(func() {
+		close(h.closed)
+	})
+}
+
+// startFetchLocked returns the in-flight fetch, starting one if there is
+// none. h.mu must be held.
+func (h *tokenHolder) startFetchLocked() *tokenCall {
+	if h.inflight != nil {
+		return h.inflight
+	}
+
+	call := &tokenCall{done: make(chan struct{})}
+	h.inflight = call
+
+	go h.doFetch(call)
+	return call
+}
+
+func (h *tokenHolder) doFetch(call *tokenCall) {
+	ctx, cancel := context.WithTimeout(context.Background(), tokenFetchTimeout)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-h.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	t, err := h.obtain(ctx)
+
+	h.mu.Lock()
+	if err == nil {
+		h.token = t.AccessToken
+		h.expiresAt = t.ExpiresAt
+		h.refreshAt = t.RefreshAt
+
+		select {
+		case h.updated <- struct{}{}:
+		default:
+		}
+	}
+
+	h.inflight = nil
+	h.mu.Unlock()
+
+	if err == nil {
+		call.token = t.AccessToken
+	}
+
+	call.err = err
+	close(call.done)
+}
+
+// obtain returns the stored token if it is still fresh, or fetches and
+// stores a new one. The store lock is held throughout so that only one
+// client fetches at a time. If the lock cannot be taken within
+// tokenLockTimeout, e.g. because its holder hung, the token is fetched
+// without it.
+func (h *tokenHolder) obtain(ctx context.Context) (*Token, error) {
+	lockCtx, cancel := context.WithTimeout(ctx, tokenLockTimeout)
+	unlock, err := h.store.Lock(lockCtx, h.key)
+	cancel()
+
 	if err != nil {
-		return nil, fmt.Errorf("http.Get error: %v", err)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		glog.Warningf("Lock access token %v in store failed. Fetching without the lock. %v", h.key, err)
+		unlock = func() {}
 	}
 
-	defer httpResp.Body.Close()
+	defer unlock()
+
+	h.mu.Lock()
+	rejected := h.rejected
+	h.mu.Unlock()
+
+	stored, err := h.store.Load(h.key)
+	if err != nil {
+		glog.Warningf("Load access token from store failed. %v", err)
+	} else if stored != nil && stored.AccessToken != rejected && time.Now().Before(stored.RefreshAt) {
+		return stored, nil
+	}
 
-	body, err := ioutil.ReadAll(httpResp.Body)
+	token, ttl, err := h.fetch(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("http response read error: %v", err)
+		return nil, err
 	}
 
-	if httpResp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("illegal http status code: %v", httpResp.StatusCode)
+	if ttl <= 0 {
+		glog.Warningf("Access token %v fetched without a lifetime. Assuming %v", h.key, defaultTokenTTL)
+		ttl = defaultTokenTTL
 	}
 
-	var resp GetAccessTokenResponse
-	if err := json.Unmarshal(body, &resp); err != nil {
-		return nil, fmt.Errorf("json.Unmarshal error: %v", err)
+	now := time.Now()
+	t := &Token{
+		AccessToken: token,
+		ExpiresAt:   now.Add(ttl),
+		RefreshAt:   now.Add(time.Duration(float64(ttl) * h.refreshRatio)),
 	}
 
-	if resp.Code != 0 {
-		return nil, fmt.Errorf("token.get api error: %+v", resp)
+	if err := h.store.Save(h.key, t); err != nil {
+		glog.Warningf("Save access token to store failed. %v", err)
 	}
 
-	return &resp, nil
+	return t, nil
+}
+
+func (h *tokenHolder) refreshLoop() {
+	for {
+		h.mu.Lock()
+		refreshAt := h.refreshAt
+		h.mu.Unlock()
+
+		var timer *time.Timer
+		var wait <-chan time.Time
+		if !refreshAt.IsZero() {
+			timer = time.NewTimer(time.Until(refreshAt))
+			wait = timer.C
+		}
+
+		select {
+		case <-h.closed:
+			stopTimer(timer)
+			return
+		case <-h.updated:
+			stopTimer(timer)
+			continue
+		case <-wait:
+		}
+
+		h.mu.Lock()
+		call := h.startFetchLocked()
+		h.mu.Unlock()
+
+		select {
+		case <-h.closed:
+			return
+		case <-call.done:
+		}
+
+		if call.err != nil {
+			glog.Errorf("Refresh access token failed. %v", call.err)
+
+			select {
+			case <-h.closed:
+				return
+			case <-time.After(tokenRetryInterval):
+			}
+		}
+	}
+}
+
+func stopTimer(t *time.Timer) {
+	if t != nil {
+		t.Stop()
+	}
 }
@@ -0,0 +1,165 @@
+package wework
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingFetcher returns tokens "token-1", "token-2"... once release is
+// closed, counting the fetches started.
+func blockingFetcher(release <-chan struct{}, fetches *int32) tokenFetcher {
+	return func(ctx context.Context) (string, time.Duration, error) {
+		n := atomic.AddInt32(fetches, 1)
+
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return "", 0, ctx.Err()
+		}
+
+		return fmt.Sprintf("token-%d", n), time.Hour, nil
+	}
+}
+
+func TestTokenHolderCollapsesFetches(t *testing.T) {
+	tests := []struct {
+		name    string
+		readers int
+	}{
+		{"one reader", 1},
+		{"concurrent readers", 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fetches int32
+			release := make(chan struct{})
+
+			h := newTokenHolder("test", NewMemoryTokenStore(), blockingFetcher(release, &fetches), DefaultTokenRefreshRatio)
+			defer h.close()
+
+			var wg sync.WaitGroup
+			tokens := make([]string, tt.readers)
+			errs := make([]error, tt.readers)
+			for i := 0; i < tt.readers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					tokens[i], errs[i] = h.get(context.Background())
+				}(i)
+			}
+
+			waitFor(t, func() bool { return atomic.LoadInt32(&fetches) > 0 })
+			close(release)
+			wg.Wait()
+
+			if n := atomic.LoadInt32(&fetches); n != 1 {
+				t.Errorf("fetches = %d, want 1", n)
+			}
+
+			for i := range tokens {
+				if errs[i] != nil || tokens[i] != "token-1" {
+					t.Errorf("reader %d got %q, %v, want token-1", i, tokens[i], errs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTokenHolderServesTokenDuringRefresh(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+
+	h := newTokenHolder("test", NewMemoryTokenStore(), blockingFetcher(release, &fetches), DefaultTokenRefreshRatio)
+	defer h.close()
+
+	h.mu.Lock()
+	h.token = "old"
+	h.expiresAt = time.Now().Add(time.Minute)
+	h.refreshAt = time.Now().Add(-time.Second)
+	h.mu.Unlock()
+
+	token, err := h.get(context.Background())
+	if err != nil || token != "old" {
+		t.Fatalf("get = %q, %v, want old", token, err)
+	}
+
+	waitFor(t, func() bool { return atomic.LoadInt32(&fetches) == 1 })
+	close(release)
+
+	waitFor(t, func() bool {
+		token, err := h.get(context.Background())
+		return err == nil && token == "token-1"
+	})
+
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("fetches = %d, want 1", n)
+	}
+}
+
+func TestTokenHolderReportsFetchError(t *testing.T) {
+	errFetch := errors.New("fetch failed")
+	var fetches int32
+
+	h := newTokenHolder("test", NewMemoryTokenStore(), func(ctx context.Context) (string, time.Duration, error) {
+		atomic.AddInt32(&fetches, 1)
+		return "", 0, errFetch
+	}, DefaultTokenRefreshRatio)
+	defer h.close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := h.get(context.Background()); err != errFetch {
+			t.Fatalf("get error = %v, want %v", err, errFetch)
+		}
+	}
+
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("fetches = %d, want 2", n)
+	}
+}
+
+func TestTokenHolderDefaultsMissingLifetime(t *testing.T) {
+	var fetches int32
+
+	h := newTokenHolder("test", NewMemoryTokenStore(), func(ctx context.Context) (string, time.Duration, error) {
+		atomic.AddInt32(&fetches, 1)
+		return "token", 0, nil
+	}, DefaultTokenRefreshRatio)
+	defer h.close()
+
+	if token, err := h.get(context.Background()); err != nil || token != "token" {
+		t.Fatalf("get = %q, %v, want token", token, err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("fetches = %d, want 1", n)
+	}
+
+	h.mu.Lock()
+	ttl := time.Until(h.expiresAt)
+	h.mu.Unlock()
+
+	if ttl < defaultTokenTTL-time.Minute {
+		t.Errorf("token expires in %v, want about %v", ttl, defaultTokenTTL)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
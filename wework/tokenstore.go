@@ -0,0 +1,80 @@
+package wework
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Token is an access token as kept in a TokenStore.
+type Token struct {
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	RefreshAt   time.Time `json:"refresh_at"`
+}
+
+// TokenStore keeps access tokens so that they can be shared between clients,
+// possibly running in different processes.
+type TokenStore interface {
+	// Lock acquires exclusive access to key and returns a func releasing it.
+	// It gives up with the error of ctx once ctx is done.
+	Lock(ctx context.Context, key string) (func(), error)
+
+	// Load returns the token saved under key, or nil if there is none.
+	Load(key string) (*Token, error)
+
+	// Save stores t under key.
+	Save(key string, t *Token) error
+}
+
+type memoryTokenStore struct {
+	mu     *sync.Mutex
+	locks  map[string]chan struct{}
+	tokens map[string]Token
+}
+
+// NewMemoryTokenStore returns a TokenStore sharing tokens within the process.
+func NewMemoryTokenStore() TokenStore {
+	return &memoryTokenStore{
+		mu:     &sync.Mutex{},
+		locks:  make(map[string]chan struct{}),
+		tokens: make(map[string]Token),
+	}
+}
+
+func (s *memoryTokenStore) Lock(ctx context.Context, key string) (func(), error) {
+	s.mu.Lock()
+	l, ok := s.locks[key]
+	if !ok {
+		l = make(chan struct{}, 1)
+		s.locks[key] = l
+	}
+	s.mu.Unlock()
+
+	select {
+	case l <- struct{}{}:
+		return func() { <-l }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *memoryTokenStore) Load(key string) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[key]
+	if !ok {
+		return nil, nil
+	}
+
+	return &t, nil
+}
+
+func (s *memoryTokenStore) Save(key string, t *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[key] = *t
+	return nil
+}
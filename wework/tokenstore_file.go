@@ -0,0 +1,116 @@
+package wework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pragkent/hydra-wework/internal/fsutil"
+)
+
+const (
+	lockRetryInterval = 50 * time.Millisecond
+)
+
+type fileTokenStore struct {
+	dir string
+}
+
+// NewFileTokenStore returns a TokenStore keeping one file per key in dir.
+// Access is serialized with file locks, so processes sharing dir (e.g. over
+// a shared volume) reuse each other's tokens. File locks are not supported
+// on windows.
+func NewFileTokenStore(dir string) (TokenStore, error) {
+	if !fsutil.LockSupported {
+		return nil, errors.New("file token store is not supported on this platform")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create token store dir error: %v", err)
+	}
+
+	return &fileTokenStore{dir: dir}, nil
+}
+
+func (s *fileTokenStore) path(key, ext string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+
+	return filepath.Join(s.dir, name+ext)
+}
+
+// Lock polls the lock file of key until it is free or ctx is done, since a
+// blocking flock cannot be cancelled.
+func (s *fileTokenStore) Lock(ctx context.Context, key string) (func(), error) {
+	f, err := os.OpenFile(s.path(key, ".lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open lock file error: %v", err)
+	}
+
+	for {
+		ok, err := fsutil.TryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("lock file error: %v", err)
+		}
+
+		if ok {
+			return func() {
+				fsutil.Unlock(f)
+				f.Close()
+			}, nil
+		}
+
+		timer := time.NewTimer(lockRetryInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			f.Close()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *fileTokenStore) Load(key string) (*Token, error) {
+	data, err := ioutil.ReadFile(s.path(key, ".json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("read token file error: %v", err)
+	}
+
+	var t Token
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal error: %v", err)
+	}
+
+	return &t, nil
+}
+
+func (s *fileTokenStore) Save(key string, t *Token) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("json.Marshal error: %v", err)
+	}
+
+	if err := fsutil.WriteFileAtomic(s.path(key, ".json"), data); err != nil {
+		return fmt.Errorf("write token file error: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package wework
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pragkent/hydra-wework/internal/fsutil"
+)
+
+func TestTokenStoreLockHonoursContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tokenstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name  string
+		store func() (TokenStore, error)
+	}{
+		{"memory", func() (TokenStore, error) { return NewMemoryTokenStore(), nil }},
+		{"file", func() (TokenStore, error) { return NewFileTokenStore(dir) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "file" && !fsutil.LockSupported {
+				t.Skip("file locks are not supported")
+			}
+
+			s, err := tt.store()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			unlock, err := s.Lock(context.Background(), "corp.app")
+			if err != nil {
+				t.Fatalf("Lock error: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			if _, err := s.Lock(ctx, "corp.app"); err != context.DeadlineExceeded {
+				t.Fatalf("Lock of held key error = %v, want %v", err, context.DeadlineExceeded)
+			}
+
+			other, err := s.Lock(context.Background(), "corp.other")
+			if err != nil {
+				t.Fatalf("Lock of other key error: %v", err)
+			}
+
+			other()
+			unlock()
+
+			unlock, err = s.Lock(context.Background(), "corp.app")
+			if err != nil {
+				t.Fatalf("Lock after unlock error: %v", err)
+			}
+
+			unlock()
+		})
+	}
+}
+
+func TestFileTokenStoreSaveLoad(t *testing.T) {
+	if !fsutil.LockSupported {
+		t.Skip("file locks are not supported")
+	}
+
+	dir, err := ioutil.TempDir("", "tokenstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileTokenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tok, err := s.Load("corp.app"); tok != nil || err != nil {
+		t.Fatalf("Load of missing key = %v, %v, want nil", tok, err)
+	}
+
+	now := time.Now().Round(time.Second)
+	want := &Token{AccessToken: "token", ExpiresAt: now.Add(time.Hour), RefreshAt: now.Add(time.Minute)}
+	if err := s.Save("corp.app", want); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+
+	got, err := s.Load("corp.app")
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+
+	if got.AccessToken != want.AccessToken || !got.ExpiresAt.Equal(want.ExpiresAt) || !got.RefreshAt.Equal(want.RefreshAt) {
+		t.Errorf("Load = %+v, want %+v", got, want)
+	}
+}
@@ -1,10 +1,18 @@
 package wework
 
 import (
-	"fmt"
+	"context"
 	"net/url"
 )
 
+const (
+	getUserPath  = "/cgi-bin/user/get"
+	authSuccPath = "/cgi-bin/user/authsucc"
+
+	getUserIDByEmailPath  = "/cgi-bin/user/get_userid_by_email"
+	getUserIDByMobilePath = "/cgi-bin/user/getuserid"
+)
+
 type UserStatus int
 
 const (
@@ -13,29 +21,233 @@ const (
 	UserInactive UserStatus = 3
 )
 
+type Gender string
+
+const (
+	GenderUnknown Gender = "0"
+	GenderMale    Gender = "1"
+	GenderFemale  Gender = "2"
+)
+
+type User struct {
+	UserID         string     `json:"userid,omitempty"`
+	OpenUserID     string     `json:"open_userid,omitempty"`
+	Name           string     `json:"name,omitempty"`
+	Alias          string     `json:"alias,omitempty"`
+	EnglishName    string     `json:"english_name,omitempty"`
+	Mobile         string     `json:"mobile,omitempty"`
+	Email          string     `json:"email,omitempty"`
+	BizMail        string     `json:"biz_mail,omitempty"`
+	Telephone      string     `json:"telephone,omitempty"`
+	Position       string     `json:"position,omitempty"`
+	Gender         Gender     `json:"gender,omitempty"`
+	Avatar         string     `json:"avatar,omitempty"`
+	ThumbAvatar    string     `json:"thumb_avatar,omitempty"`
+	Department     []int      `json:"department,omitempty"`
+	Order          []int      `json:"order,omitempty"`
+	MainDepartment int        `json:"main_department,omitempty"`
+	IsLeaderInDept []int      `json:"is_leader_in_dept,omitempty"`
+	DirectLeader   []string   `json:"direct_leader,omitempty"`
+	ExtAttr        *ExtAttr   `json:"extattr,omitempty"`
+	Status         UserStatus `json:"status,omitempty"`
+}
+
+// IsLeaderOf reports whether the user leads department deptID.
+func (u *User) IsLeaderOf(deptID int) bool {
+	for i, d := range u.Department {
+		if d == deptID && i < len(u.IsLeaderInDept) {
+			return u.IsLeaderInDept[i] == 1
+		}
+	}
+
+	return false
+}
+
+// PrimaryDepartment returns the main department, falling back to the first
+// one listed for users without a main department.
+func (u *User) PrimaryDepartment() int {
+	if u.MainDepartment != 0 {
+		return u.MainDepartment
+	}
+
+	if len(u.Department) > 0 {
+		return u.Department[0]
+	}
+
+	return 0
+}
+
+// DisplayName returns the english name if set, otherwise the name.
+func (u *User) DisplayName() string {
+	if u.EnglishName != "" {
+		return u.EnglishName
+	}
+
+	return u.Name
+}
+
+type ExtAttrType int
+
+const (
+	ExtAttrTypeText        ExtAttrType = 0
+	ExtAttrTypeWeb         ExtAttrType = 1
+	ExtAttrTypeMiniprogram ExtAttrType = 2
+)
+
+type ExtAttr struct {
+	Attrs []ExtAttrItem `json:"attrs,omitempty"`
+}
+
+// Get returns the attribute named name, or nil if there is none.
+func (e *ExtAttr) Get(name string) *ExtAttrItem {
+	if e == nil {
+		return nil
+	}
+
+	for i := range e.Attrs {
+		if e.Attrs[i].Name == name {
+			return &e.Attrs[i]
+		}
+	}
+
+	return nil
+}
+
+// ExtAttrItem is a custom attribute. Exactly one of Text, Web and
+// Miniprogram is set, depending on Type.
+type ExtAttrItem struct {
+	Type        ExtAttrType         `json:"type"`
+	Name        string              `json:"name"`
+	Text        *ExtAttrText        `json:"text,omitempty"`
+	Web         *ExtAttrWeb         `json:"web,omitempty"`
+	Miniprogram *ExtAttrMiniprogram `json:"miniprogram,omitempty"`
+}
+
+// String returns the text value, the web url or the miniprogram page path.
+func (i *ExtAttrItem) String() string {
+	switch {
+	case i.Text != nil:
+		return i.Text.Value
+	case i.Web != nil:
+		return i.Web.URL
+	case i.Miniprogram != nil:
+		return i.Miniprogram.PagePath
+	default:
+		return ""
+	}
+}
+
+type ExtAttrText struct {
+	Value string `json:"value"`
+}
+
+type ExtAttrWeb struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+}
+
+type ExtAttrMiniprogram struct {
+	AppID    string `json:"appid"`
+	PagePath string `json:"pagepath"`
+	Title    string `json:"title"`
+}
+
 type GetUserResponse struct {
-	Code        int        `json:"errcode,omitempty"`
-	Message     string     `json:"errmsg,omitempty"`
-	UserID      string     `json:"userid,omitempty"`
-	EnglishName string     `json:"english_name,omitempty"`
-	Email       string     `json:"email,omitempty"`
-	Status      UserStatus `json:"status,omitempty"`
+	Code    int    `json:"errcode,omitempty"`
+	Message string `json:"errmsg,omitempty"`
+	User
 }
 
 func (c *Client) GetUser(uid string) (*GetUserResponse, error) {
+	return c.GetUserContext(context.Background(), uid)
+}
+
+func (c *Client) GetUserContext(ctx context.Context, uid string) (*GetUserResponse, error) {
 	q := url.Values{}
 	q.Set("userid", uid)
 
-	u := "https://qyapi.weixin.qq.com/cgi-bin/user/get?" + q.Encode()
+	u := getUserPath + "?" + q.Encode()
 
 	var resp GetUserResponse
-	if err := c.getJSON(u, &resp); err != nil {
+	if err := c.getJSON(ctx, CredentialApp, u, &resp); err != nil {
 		return nil, err
 	}
 
-	if resp.Code != 0 {
-		return nil, fmt.Errorf("Get user error: %v %v", resp.Code, resp.Message)
+	return &resp, nil
+}
+
+// AuthSucc completes the secondary verification of uid, letting the new
+// member join the corp.
+func (c *Client) AuthSucc(uid string) error {
+	return c.AuthSuccContext(context.Background(), uid)
+}
+
+func (c *Client) AuthSuccContext(ctx context.Context, uid string) error {
+	q := url.Values{}
+	q.Set("userid", uid)
+
+	u := authSuccPath + "?" + q.Encode()
+
+	var resp baseResponse
+	return c.getJSON(ctx, CredentialContacts, u, &resp)
+}
+
+type EmailType int
+
+const (
+	EmailTypeBiz      EmailType = 1
+	EmailTypePersonal EmailType = 2
+)
+
+type GetUserIDByEmailRequest struct {
+	Email     string    `json:"email"`
+	EmailType EmailType `json:"email_type,omitempty"`
+}
+
+type GetUserIDByMobileRequest struct {
+	Mobile string `json:"mobile"`
+}
+
+type GetUserIDResponse struct {
+	Code    int    `json:"errcode,omitempty"`
+	Message string `json:"errmsg,omitempty"`
+	UserID  string `json:"userid,omitempty"`
+}
+
+// GetUserIDByEmail returns the id of the member with the business mail or
+// the personal email address, depending on emailType.
+func (c *Client) GetUserIDByEmail(email string, emailType EmailType) (string, error) {
+	return c.GetUserIDByEmailContext(context.Background(), email, emailType)
+}
+
+func (c *Client) GetUserIDByEmailContext(ctx context.Context, email string, emailType EmailType) (string, error) {
+	req := GetUserIDByEmailRequest{
+		Email:     email,
+		EmailType: emailType,
 	}
 
-	return &resp, nil
+	var resp GetUserIDResponse
+	if err := c.postJSON(ctx, CredentialContacts, getUserIDByEmailPath, &req, &resp); err != nil {
+		return "", err
+	}
+
+	return resp.UserID, nil
+}
+
+// GetUserIDByMobile returns the id of the member with the mobile number.
+func (c *Client) GetUserIDByMobile(mobile string) (string, error) {
+	return c.GetUserIDByMobileContext(context.Background(), mobile)
+}
+
+func (c *Client) GetUserIDByMobileContext(ctx context.Context, mobile string) (string, error) {
+	req := GetUserIDByMobileRequest{
+		Mobile: mobile,
+	}
+
+	var resp GetUserIDResponse
+	if err := c.postJSON(ctx, CredentialContacts, getUserIDByMobilePath, &req, &resp); err != nil {
+		return "", err
+	}
+
+	return resp.UserID, nil
 }
@@ -0,0 +1,172 @@
+package wework
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+const (
+	listSimpleUsersPath = "/cgi-bin/user/simplelist"
+	listUsersPath       = "/cgi-bin/user/list"
+	listUserIDsPath     = "/cgi-bin/user/list_id"
+
+	listUserIDsLimit = 1000
+)
+
+type ListUsersResponse struct {
+	Code    int    `json:"errcode,omitempty"`
+	Message string `json:"errmsg,omitempty"`
+	Users   []User `json:"userlist,omitempty"`
+}
+
+type ListUserIDsRequest struct {
+	Cursor string `json:"cursor,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+type DeptUser struct {
+	UserID     string `json:"userid"`
+	Department int    `json:"department"`
+}
+
+type ListUserIDsResponse struct {
+	Code       int        `json:"errcode,omitempty"`
+	Message    string     `json:"errmsg,omitempty"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+	DeptUsers  []DeptUser `json:"dept_user,omitempty"`
+}
+
+// userPageFetcher returns the users following cursor and the cursor of the
+// next page, which is empty on the last page.
+type userPageFetcher func(ctx context.Context, cursor string) ([]User, string, error)
+
+// UserIterator iterates over users fetched page by page.
+//
+//	it := c.ListUsersByDepartment(1, true, false)
+//	for it.Next() {
+//		fmt.Println(it.User().UserID)
+//	}
+//	err := it.Err()
+type UserIterator struct {
+	ctx     context.Context
+	fetch   userPageFetcher
+	users   []User
+	cursor  string
+	started bool
+	user    *User
+	err     error
+}
+
+func newUserIterator(ctx context.Context, fetch userPageFetcher) *UserIterator {
+	return &UserIterator{
+		ctx:   ctx,
+		fetch: fetch,
+	}
+}
+
+// Next advances to the next user, fetching the next page if needed. It
+// returns false when there are no more users or an error occurred.
+func (it *UserIterator) Next() bool {
+	for len(it.users) == 0 {
+		if it.err != nil || (it.started && it.cursor == "") {
+			it.user = nil
+			return false
+		}
+
+		users, next, err := it.fetch(it.ctx, it.cursor)
+		if err != nil {
+			it.err = err
+			it.user = nil
+			return false
+		}
+
+		it.started = true
+		it.users = users
+		it.cursor = next
+	}
+
+	it.user = &it.users[0]
+	it.users = it.users[1:]
+	return true
+}
+
+// User returns the current user.
+func (it *UserIterator) User() *User {
+	return it.user
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *UserIterator) Err() error {
+	return it.err
+}
+
+// All drains the iterator and returns the remaining users.
+func (it *UserIterator) All() ([]User, error) {
+	var users []User
+	for it.Next() {
+		users = append(users, *it.User())
+	}
+
+	return users, it.Err()
+}
+
+// ListUsersByDepartment iterates over the members of deptID, including those
+// of its descendants if recursive is set. If detailed is set, full profiles
+// are returned, otherwise only userid, name and departments.
+func (c *Client) ListUsersByDepartment(deptID int, recursive, detailed bool) *UserIterator {
+	return c.ListUsersByDepartmentContext(context.Background(), deptID, recursive, detailed)
+}
+
+func (c *Client) ListUsersByDepartmentContext(ctx context.Context, deptID int, recursive, detailed bool) *UserIterator {
+	return newUserIterator(ctx, func(ctx context.Context, cursor string) ([]User, string, error) {
+		q := url.Values{}
+		q.Set("department_id", strconv.Itoa(deptID))
+		if recursive {
+			q.Set("fetch_child", "1")
+		}
+
+		path := listSimpleUsersPath
+		if detailed {
+			path = listUsersPath
+		}
+
+		var resp ListUsersResponse
+		if err := c.getJSON(ctx, CredentialContacts, path+"?"+q.Encode(), &resp); err != nil {
+			return nil, "", err
+		}
+
+		return resp.Users, "", nil
+	})
+}
+
+// ListUserIDs iterates over all members of the corp using the cursor based
+// list_id api. Only UserID and Department are set, and a member of several
+// departments is returned once for each of them.
+func (c *Client) ListUserIDs() *UserIterator {
+	return c.ListUserIDsContext(context.Background())
+}
+
+func (c *Client) ListUserIDsContext(ctx context.Context) *UserIterator {
+	return newUserIterator(ctx, func(ctx context.Context, cursor string) ([]User, string, error) {
+		req := ListUserIDsRequest{
+			Cursor: cursor,
+			Limit:  listUserIDsLimit,
+		}
+
+		var resp ListUserIDsResponse
+		if err := c.postJSON(ctx, CredentialContacts, listUserIDsPath, &req, &resp); err != nil {
+			return nil, "", err
+		}
+
+		users := make([]User, 0, len(resp.DeptUsers))
+		for _, du := range resp.DeptUsers {
+			users = append(users, User{
+				UserID:     du.UserID,
+				Department: []int{du.Department},
+			})
+		}
+
+		return users, resp.NextCursor, nil
+	})
+}
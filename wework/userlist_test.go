@@ -0,0 +1,157 @@
+package wework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// pageFetcher serves pages of user ids, following the cursors "1", "2"...
+// It fails with err when asked for page failAt.
+func pageFetcher(pages [][]string, failAt int, err error, cursors *[]string) userPageFetcher {
+	return func(ctx context.Context, cursor string) ([]User, string, error) {
+		*cursors = append(*cursors, cursor)
+
+		i := len(*cursors) - 1
+		if i == failAt {
+			return nil, "", err
+		}
+
+		var users []User
+		for _, uid := range pages[i] {
+			users = append(users, User{UserID: uid})
+		}
+
+		next := ""
+		if i+1 < len(pages) {
+			next = string(rune('1' + i))
+		}
+
+		return users, next, nil
+	}
+}
+
+func TestUserIteratorPaging(t *testing.T) {
+	errPage := errors.New("page failed")
+
+	tests := []struct {
+		name        string
+		pages       [][]string
+		failAt      int
+		want        []string
+		wantErr     error
+		wantCursors []string
+	}{
+		{
+			name:        "single page",
+			pages:       [][]string{{"a", "b"}},
+			failAt:      -1,
+			want:        []string{"a", "b"},
+			wantCursors: []string{""},
+		},
+		{
+			name:        "several pages",
+			pages:       [][]string{{"a", "b"}, {"c"}, {"d", "e"}},
+			failAt:      -1,
+			want:        []string{"a", "b", "c", "d", "e"},
+			wantCursors: []string{"", "1", "2"},
+		},
+		{
+			name:        "empty pages",
+			pages:       [][]string{{}, {"a"}, {}},
+			failAt:      -1,
+			want:        []string{"a"},
+			wantCursors: []string{"", "1", "2"},
+		},
+		{
+			name:        "no users",
+			pages:       [][]string{{}},
+			failAt:      -1,
+			wantCursors: []string{""},
+		},
+		{
+			name:        "failed page",
+			pages:       [][]string{{"a"}, {"b"}, {"c"}},
+			failAt:      1,
+			want:        []string{"a"},
+			wantErr:     errPage,
+			wantCursors: []string{"", "1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cursors []string
+			it := newUserIterator(context.Background(), pageFetcher(tt.pages, tt.failAt, errPage, &cursors))
+
+			var got []string
+			for it.Next() {
+				got = append(got, it.User().UserID)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("users = %v, want %v", got, tt.want)
+			}
+
+			if it.Err() != tt.wantErr {
+				t.Errorf("Err = %v, want %v", it.Err(), tt.wantErr)
+			}
+
+			if it.Next() || it.User() != nil {
+				t.Error("Next after the end = true, want false")
+			}
+
+			if !reflect.DeepEqual(cursors, tt.wantCursors) {
+				t.Errorf("cursors = %q, want %q", cursors, tt.wantCursors)
+			}
+		})
+	}
+}
+
+func TestListUserIDsFollowsCursor(t *testing.T) {
+	pages := map[string]ListUserIDsResponse{
+		"":   {NextCursor: "c1", DeptUsers: []DeptUser{{UserID: "a", Department: 1}, {UserID: "b", Department: 2}}},
+		"c1": {DeptUsers: []DeptUser{{UserID: "a", Department: 3}}},
+	}
+
+	var cursors []string
+	mux := http.NewServeMux()
+	mux.HandleFunc(getTokenPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "expires_in": 7200})
+	})
+	mux.HandleFunc(listUserIDsPath, func(w http.ResponseWriter, r *http.Request) {
+		var req ListUserIDsRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		cursors = append(cursors, req.Cursor)
+		json.NewEncoder(w).Encode(pages[req.Cursor])
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := NewClient("corp", "1000002", "secret", WithBaseURL(srv.URL))
+	defer c.Close()
+
+	users, err := c.ListUserIDs().All()
+	if err != nil {
+		t.Fatalf("ListUserIDs error: %v", err)
+	}
+
+	want := []User{
+		{UserID: "a", Department: []int{1}},
+		{UserID: "b", Department: []int{2}},
+		{UserID: "a", Department: []int{3}},
+	}
+
+	if !reflect.DeepEqual(users, want) {
+		t.Errorf("ListUserIDs = %+v, want %+v", users, want)
+	}
+
+	if !reflect.DeepEqual(cursors, []string{"", "c1"}) {
+		t.Errorf("cursors = %q, want [\"\" \"c1\"]", cursors)
+	}
+}
@@ -0,0 +1,152 @@
+package weworktest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pragkent/hydra-wework/wework"
+)
+
+// Fault is a failure injected into calls to an api path.
+type Fault struct {
+	// Code is the errcode returned instead of the normal response.
+	Code int
+
+	// StatusCode is the http status returned instead of the normal
+	// response. It takes precedence over Code.
+	StatusCode int
+
+	// Latency delays the response, successful or not.
+	Latency time.Duration
+
+	// Times is the number of calls affected, 0 for all calls.
+	Times int
+}
+
+// Inject makes calls to path, e.g. "/cgi-bin/user/get", fail with f.
+// Faults of a path apply in the order injected. An empty path matches all
+// apis.
+func (s *Server) Inject(path string, f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults[path] = append(s.faults[path], &f)
+}
+
+// FailNext makes the next n calls to path return errcode code.
+func (s *Server) FailNext(path string, code, n int) {
+	s.Inject(path, Fault{Code: code, Times: n})
+}
+
+// ClearFaults removes all injected faults and latency.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = make(map[string][]*Fault)
+	s.latency = 0
+}
+
+// SetLatency delays every response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = d
+}
+
+// ExpireTokens expires all access tokens issued so far, so the next calls
+// using them fail with errcode 42001.
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for token := range s.tokens {
+		s.tokens[token] = time.Time{}
+	}
+}
+
+// RevokeTokens forgets all access tokens issued so far, so the next calls
+// using them fail with errcode 40014.
+func (s *Server) RevokeTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens = make(map[string]time.Time)
+}
+
+// Calls returns the number of calls received for path, including failed
+// ones. An empty path counts all calls.
+func (s *Server) Calls(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if path == "" {
+		n := 0
+		for _, c := range s.calls {
+			n += c
+		}
+
+		return n
+	}
+
+	return s.calls[path]
+}
+
+// intercept counts calls and applies latency and faults before h.
+func (s *Server) intercept(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+
+		s.mu.Lock()
+		s.calls[path]++
+		latency := s.latency
+		f := s.nextFaultLocked(path)
+		if f == nil {
+			f = s.nextFaultLocked("")
+		}
+		s.mu.Unlock()
+
+		if f != nil {
+			latency += f.Latency
+		}
+
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		switch {
+		case f == nil || f.StatusCode == 0 && f.Code == wework.ErrCodeOK:
+			h.ServeHTTP(w, r)
+		case f.StatusCode != 0:
+			http.Error(w, http.StatusText(f.StatusCode), f.StatusCode)
+		default:
+			writeError(w, f.Code)
+		}
+	})
+}
+
+// nextFaultLocked returns the fault applying to the current call of path,
+// consuming one of its times.
+func (s *Server) nextFaultLocked(path string) *Fault {
+	faults := s.faults[path]
+	if len(faults) == 0 {
+		return nil
+	}
+
+	f := faults[0]
+	if f.Times == 0 {
+		return f
+	}
+
+	f.Times--
+	if f.Times == 0 {
+		s.faults[path] = faults[1:]
+	}
+
+	return f
+}
@@ -0,0 +1,583 @@
+// Package weworktest provides an in-process fake of the wework api for
+// hermetic tests of wework clients.
+package weworktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pragkent/hydra-wework/wework"
+)
+
+const (
+	DefaultCorpID  = "wwtestcorp"
+	DefaultAgentID = "1000001"
+	DefaultSecret  = "testsecret"
+
+	DefaultContactsSecret = "testcontactssecret"
+
+	DefaultTokenTTL = 2 * time.Hour
+)
+
+// Server is a fake wework api serving a scripted in-memory directory. It
+// implements token issuance, oauth user info, users, departments, tags, the
+// agent, app messages and approvals.
+type Server struct {
+	*httptest.Server
+
+	CorpID   string
+	AgentID  string
+	Secret   string
+	TokenTTL time.Duration
+
+	// ContactsSecret is accepted along with Secret, for clients using the
+	// contacts credential.
+	ContactsSecret string
+
+	mu       *sync.Mutex
+	users    map[string]*wework.User
+	depts    map[int]wework.Department
+	tags     map[int]*tagEntry
+	agent    *wework.Agent
+	codes    map[string]string
+	tokens   map[string]time.Time
+	messages []wework.Message
+	faults   map[string][]*Fault
+	latency  time.Duration
+	calls    map[string]int
+	seq      int
+
+	approvals map[string]*approvalEntry
+}
+
+type approvalEntry struct {
+	request wework.ApplyEventRequest
+	detail  wework.ApprovalDetail
+}
+
+type tagEntry struct {
+	tag   wework.Tag
+	users []string
+	depts []int
+}
+
+// NewServer starts a server with the default credentials, an empty
+// directory but for the root department, and an agent visible to the whole
+// corp. It must be closed when done.
+func NewServer() *Server {
+	s := &Server{
+		CorpID:   DefaultCorpID,
+		AgentID:  DefaultAgentID,
+		Secret:   DefaultSecret,
+		TokenTTL: DefaultTokenTTL,
+		mu:       &sync.Mutex{},
+		users:    make(map[string]*wework.User),
+		depts:    make(map[int]wework.Department),
+		tags:     make(map[int]*tagEntry),
+		codes:    make(map[string]string),
+		tokens:   make(map[string]time.Time),
+		faults:   make(map[string][]*Fault),
+		calls:    make(map[string]int),
+	}
+
+	s.approvals = make(map[string]*approvalEntry)
+
+	s.ContactsSecret = DefaultContactsSecret
+	s.depts[wework.RootDepartmentID] = wework.Department{ID: wework.RootDepartmentID, Name: "Corp"}
+	s.agent = &wework.Agent{
+		AgentID:          s.agentID(),
+		Name:             "Test App",
+		AllowDepartments: wework.AgentAllowPartys{IDs: []int{wework.RootDepartmentID}},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cgi-bin/gettoken", s.handleGetToken)
+	mux.HandleFunc("/cgi-bin/user/getuserinfo", s.withToken(s.handleGetUserInfo))
+	mux.HandleFunc("/cgi-bin/user/get", s.withToken(s.handleGetUser))
+	mux.HandleFunc("/cgi-bin/user/get_userid_by_email", s.withToken(s.handleGetUserIDByEmail))
+	mux.HandleFunc("/cgi-bin/user/getuserid", s.withToken(s.handleGetUserIDByMobile))
+	mux.HandleFunc("/cgi-bin/user/simplelist", s.withToken(s.handleListUsers))
+	mux.HandleFunc("/cgi-bin/user/list", s.withToken(s.handleListUsers))
+	mux.HandleFunc("/cgi-bin/department/list", s.withToken(s.handleListDepartments))
+	mux.HandleFunc("/cgi-bin/department/get", s.withToken(s.handleGetDepartment))
+	mux.HandleFunc("/cgi-bin/tag/list", s.withToken(s.handleListTags))
+	mux.HandleFunc("/cgi-bin/tag/get", s.withToken(s.handleGetTagMembers))
+	mux.HandleFunc("/cgi-bin/agent/get", s.withToken(s.handleGetAgent))
+	mux.HandleFunc("/cgi-bin/message/send", s.withToken(s.handleSendMessage))
+	mux.HandleFunc("/cgi-bin/oa/applyevent", s.withToken(s.handleApplyEvent))
+	mux.HandleFunc("/cgi-bin/oa/getapprovaldetail", s.withToken(s.handleGetApprovalDetail))
+
+	s.Server = httptest.NewServer(s.intercept(mux))
+	return s
+}
+
+// Client returns a client of the fake corp talking to the server.
+func (s *Server) Client(opts ...wework.Option) *wework.Client {
+	opts = append([]wework.Option{wework.WithBaseURL(s.URL)}, opts...)
+	return wework.NewClient(s.CorpID, s.AgentID, s.Secret, opts...)
+}
+
+// AddUser adds or replaces a member. Status defaults to active.
+func (s *Server) AddUser(u wework.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u.Status == 0 {
+		u.Status = wework.UserActive
+	}
+
+	s.users[u.UserID] = &u
+}
+
+// RemoveUser deletes a member, as if it left the corp.
+func (s *Server) RemoveUser(uid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.users, uid)
+}
+
+// AddDepartment adds or replaces a department.
+func (s *Server) AddDepartment(d wework.Department) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.depts[d.ID] = d
+}
+
+// AddTag adds or replaces a tag applied to users and departments.
+func (s *Server) AddTag(t wework.Tag, users []string, depts []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tags[t.ID] = &tagEntry{tag: t, users: users, depts: depts}
+}
+
+// SetAgent replaces the agent returned by agent/get.
+func (s *Server) SetAgent(a wework.Agent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.agent = &a
+}
+
+// Code issues a single use oauth code signing uid in. The uid need not be a
+// member, to script logins of non-members.
+func (s *Server) Code(uid string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	code := fmt.Sprintf("code-%d", s.seq)
+	s.codes[code] = uid
+	return code
+}
+
+// Messages returns the app messages sent so far.
+func (s *Server) Messages() []wework.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]wework.Message(nil), s.messages...)
+}
+
+// Approval returns the request that submitted approval spNo, or nil.
+func (s *Server) Approval(spNo string) *wework.ApplyEventRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.approvals[spNo]
+	if !ok {
+		return nil
+	}
+
+	req := a.request
+	return &req
+}
+
+// SetApprovalStatus decides approval spNo, as if its approvers did.
+func (s *Server) SetApprovalStatus(spNo string, status wework.ApprovalStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.approvals[spNo]; ok {
+		a.detail.SpStatus = status
+	}
+}
+
+func (s *Server) agentID() int {
+	id, _ := strconv.Atoi(s.AgentID)
+	return id
+}
+
+func (s *Server) handleGetToken(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("corpid") != s.CorpID {
+		writeError(w, wework.ErrCodeInvalidCorpID)
+		return
+	}
+
+	if secret := q.Get("corpsecret"); secret != s.Secret && secret != s.ContactsSecret {
+		writeError(w, wework.ErrCodeInvalidSecret)
+		return
+	}
+
+	s.mu.Lock()
+	s.seq++
+	token := fmt.Sprintf("token-%d", s.seq)
+	s.tokens[token] = time.Now().Add(s.TokenTTL)
+	s.mu.Unlock()
+
+	writeJSON(w, wework.GetAccessTokenResponse{
+		AccessToken: token,
+		ExpiresIn:   int(s.TokenTTL / time.Second),
+	})
+}
+
+// withToken rejects calls without a valid access token.
+func (s *Server) withToken(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("access_token")
+		if token == "" {
+			writeError(w, wework.ErrCodeMissingToken)
+			return
+		}
+
+		s.mu.Lock()
+		expiresAt, ok := s.tokens[token]
+		s.mu.Unlock()
+
+		if !ok {
+			writeError(w, wework.ErrCodeInvalidToken)
+			return
+		}
+
+		if time.Now().After(expiresAt) {
+			writeError(w, wework.ErrCodeTokenExpired)
+			return
+		}
+
+		h(w, r)
+	}
+}
+
+func (s *Server) handleGetUserInfo(w http.ResponseWriter, r *http.Request) {
+	code := r.URL.Query().Get("code")
+
+	s.mu.Lock()
+	uid, ok := s.codes[code]
+	delete(s.codes, code)
+	_, member := s.users[uid]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, wework.ErrCodeInvalidCode)
+		return
+	}
+
+	if !member {
+		writeJSON(w, wework.GetUserInfoResponse{OpenID: "open-" + uid})
+		return
+	}
+
+	writeJSON(w, wework.GetUserInfoResponse{UserID: uid})
+}
+
+func (s *Server) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	u, ok := s.users[r.URL.Query().Get("userid")]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, wework.ErrCodeUserIDNotFound)
+		return
+	}
+
+	writeJSON(w, wework.GetUserResponse{User: *u})
+}
+
+func (s *Server) handleGetUserIDByEmail(w http.ResponseWriter, r *http.Request) {
+	var req wework.GetUserIDByEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.findUser(w, func(u *wework.User) bool {
+		if req.EmailType == wework.EmailTypePersonal {
+			return u.Email == req.Email
+		}
+
+		return u.BizMail == req.Email
+	})
+}
+
+func (s *Server) handleGetUserIDByMobile(w http.ResponseWriter, r *http.Request) {
+	var req wework.GetUserIDByMobileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.findUser(w, func(u *wework.User) bool {
+		return u.Mobile == req.Mobile
+	})
+}
+
+// findUser responds with the id of the first member matching match.
+func (s *Server) findUser(w http.ResponseWriter, match func(u *wework.User) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.sortedUsersLocked() {
+		if match(u) {
+			writeJSON(w, wework.GetUserIDResponse{UserID: u.UserID})
+			return
+		}
+	}
+
+	writeError(w, wework.ErrCodeUserNotFound)
+}
+
+func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	deptID, _ := strconv.Atoi(q.Get("department_id"))
+	recursive := q.Get("fetch_child") == "1"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.depts[deptID]; !ok {
+		writeError(w, wework.ErrCodeDeptNotFound)
+		return
+	}
+
+	in := map[int]bool{deptID: true}
+	if recursive {
+		in = s.descendantsLocked(deptID)
+	}
+
+	var users []wework.User
+	for _, u := range s.sortedUsersLocked() {
+		for _, d := range u.Department {
+			if in[d] {
+				users = append(users, *u)
+				break
+			}
+		}
+	}
+
+	writeJSON(w, wework.ListUsersResponse{Users: users})
+}
+
+func (s *Server) handleListDepartments(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.depts[id]; id != 0 && !ok {
+		writeError(w, wework.ErrCodeDeptNotFound)
+		return
+	}
+
+	var in map[int]bool
+	if id != 0 {
+		in = s.descendantsLocked(id)
+	}
+
+	var depts []wework.Department
+	for _, d := range s.depts {
+		if in == nil || in[d.ID] {
+			depts = append(depts, d)
+		}
+	}
+
+	sort.Slice(depts, func(i, j int) bool { return depts[i].ID < depts[j].ID })
+	writeJSON(w, wework.ListDepartmentsResponse{Departments: depts})
+}
+
+func (s *Server) handleGetDepartment(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+
+	s.mu.Lock()
+	d, ok := s.depts[id]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, wework.ErrCodeDeptNotFound)
+		return
+	}
+
+	writeJSON(w, wework.GetDepartmentResponse{Department: d})
+}
+
+func (s *Server) handleListTags(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	var tags []wework.Tag
+	for _, t := range s.tags {
+		tags = append(tags, t.tag)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(tags, func(i, j int) bool { return tags[i].ID < tags[j].ID })
+	writeJSON(w, wework.ListTagsResponse{Tags: tags})
+}
+
+func (s *Server) handleGetTagMembers(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.URL.Query().Get("tagid"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tags[id]
+	if !ok {
+		writeError(w, wework.ErrCodeInvalidTagID)
+		return
+	}
+
+	resp := wework.GetTagMembersResponse{
+		TagName:     t.tag.Name,
+		Departments: t.depts,
+	}
+
+	for _, uid := range t.users {
+		tu := wework.TagUser{UserID: uid}
+		if u, ok := s.users[uid]; ok {
+			tu.Name = u.Name
+		}
+
+		resp.Users = append(resp.Users, tu)
+	}
+
+	writeJSON(w, resp)
+}
+
+func (s *Server) handleGetAgent(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	agent := *s.agent
+	s.mu.Unlock()
+
+	if r.URL.Query().Get("agentid") != strconv.Itoa(agent.AgentID) {
+		writeError(w, wework.ErrCodeInvalidAgentID)
+		return
+	}
+
+	writeJSON(w, wework.GetAgentResponse{Agent: agent})
+}
+
+func (s *Server) handleSendMessage(w http.ResponseWriter, r *http.Request) {
+	var msg wework.Message
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.messages = append(s.messages, msg)
+	s.mu.Unlock()
+
+	writeJSON(w, wework.SendMessageResponse{})
+}
+
+func (s *Server) handleApplyEvent(w http.ResponseWriter, r *http.Request) {
+	var req wework.ApplyEventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[req.CreatorUserID]; !ok {
+		writeError(w, wework.ErrCodeInvalidUserID)
+		return
+	}
+
+	if req.TemplateID == "" {
+		writeError(w, wework.ErrCodeInvalidParameter)
+		return
+	}
+
+	s.seq++
+	spNo := fmt.Sprintf("%d", 202600000000+s.seq)
+	s.approvals[spNo] = &approvalEntry{
+		request: req,
+		detail: wework.ApprovalDetail{
+			SpNo:       spNo,
+			SpStatus:   wework.ApprovalPending,
+			TemplateID: req.TemplateID,
+			ApplyTime:  time.Now().Unix(),
+			Applyer:    wework.ApprovalUser{UserID: req.CreatorUserID},
+		},
+	}
+
+	writeJSON(w, wework.ApplyEventResponse{SpNo: spNo})
+}
+
+func (s *Server) handleGetApprovalDetail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SpNo string `json:"sp_no"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.approvals[req.SpNo]
+	if !ok {
+		writeError(w, wework.ErrCodeInvalidParameter)
+		return
+	}
+
+	writeJSON(w, wework.GetApprovalDetailResponse{Info: a.detail})
+}
+
+// descendantsLocked returns id and the ids of all departments below it.
+func (s *Server) descendantsLocked(id int) map[int]bool {
+	in := map[int]bool{id: true}
+	for changed := true; changed; {
+		changed = false
+		for _, d := range s.depts {
+			if in[d.ParentID] && !in[d.ID] {
+				in[d.ID] = true
+				changed = true
+			}
+		}
+	}
+
+	return in
+}
+
+func (s *Server) sortedUsersLocked() []*wework.User {
+	var users []*wework.User
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+	return users
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int) {
+	writeJSON(w, map[string]interface{}{
+		"errcode": code,
+		"errmsg":  wework.ErrCodeText(code),
+	})
+}
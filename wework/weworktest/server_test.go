@@ -0,0 +1,345 @@
+package weworktest
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pragkent/hydra-wework/wework"
+)
+
+func TestCredentials(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		corpID   string
+		secret   string
+		wantCode int
+	}{
+		{"app secret", srv.CorpID, srv.Secret, wework.ErrCodeOK},
+		{"contacts secret", srv.CorpID, srv.ContactsSecret, wework.ErrCodeOK},
+		{"wrong secret", srv.CorpID, "wrong", wework.ErrCodeInvalidSecret},
+		{"wrong corp", "wwother", srv.Secret, wework.ErrCodeInvalidCorpID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := wework.NewClient(tt.corpID, srv.AgentID, tt.secret, wework.WithBaseURL(srv.URL))
+			defer c.Close()
+
+			_, err := c.AccessToken()
+			if code := wework.ErrorCode(err); code != tt.wantCode {
+				t.Errorf("AccessToken errcode = %d, want %d. err: %v", code, tt.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestTokens(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	c := srv.Client()
+	defer c.Close()
+
+	token, err := c.AccessToken()
+	if err != nil {
+		t.Fatalf("AccessToken error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		reject   func()
+		token    string
+		wantCode int
+	}{
+		{"valid", func() {}, token, wework.ErrCodeOK},
+		{"missing", func() {}, "", wework.ErrCodeMissingToken},
+		{"unknown", func() {}, "bogus", wework.ErrCodeInvalidToken},
+		{"expired", srv.ExpireTokens, token, wework.ErrCodeTokenExpired},
+		{"revoked", srv.RevokeTokens, token, wework.ErrCodeInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.reject()
+
+			if code := getCode(t, srv.URL+"/cgi-bin/department/get?id=1&access_token="+tt.token); code != tt.wantCode {
+				t.Errorf("errcode = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		fault      Fault
+		wantErrs   []int
+		wantStatus bool
+	}{
+		{
+			name:     "errcode once",
+			path:     "/cgi-bin/department/get",
+			fault:    Fault{Code: wework.ErrCodeSystemBusy, Times: 1},
+			wantErrs: []int{wework.ErrCodeSystemBusy, wework.ErrCodeOK, wework.ErrCodeOK},
+		},
+		{
+			name:     "errcode always",
+			path:     "/cgi-bin/department/get",
+			fault:    Fault{Code: wework.ErrCodeFrequencyLimit},
+			wantErrs: []int{wework.ErrCodeFrequencyLimit, wework.ErrCodeFrequencyLimit, wework.ErrCodeFrequencyLimit},
+		},
+		{
+			name:     "all paths",
+			path:     "",
+			fault:    Fault{Code: wework.ErrCodeSystemBusy, Times: 2},
+			wantErrs: []int{wework.ErrCodeSystemBusy, wework.ErrCodeSystemBusy, wework.ErrCodeOK},
+		},
+		{
+			name:     "other path",
+			path:     "/cgi-bin/user/get",
+			fault:    Fault{Code: wework.ErrCodeSystemBusy},
+			wantErrs: []int{wework.ErrCodeOK, wework.ErrCodeOK, wework.ErrCodeOK},
+		},
+		{
+			name:       "http status",
+			path:       "/cgi-bin/department/get",
+			fault:      Fault{StatusCode: http.StatusBadGateway, Code: wework.ErrCodeSystemBusy, Times: 1},
+			wantErrs:   []int{wework.ErrCodeOK, wework.ErrCodeOK, wework.ErrCodeOK},
+			wantStatus: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServer()
+			defer srv.Close()
+
+			c := srv.Client(wework.WithRetryPolicy(wework.RetryPolicy{}))
+			defer c.Close()
+
+			if _, err := c.AccessToken(); err != nil {
+				t.Fatalf("AccessToken error: %v", err)
+			}
+
+			srv.Inject(tt.path, tt.fault)
+
+			for i, want := range tt.wantErrs {
+				_, err := c.GetDepartment(wework.RootDepartmentID)
+
+				if _, ok := err.(*wework.StatusError); ok != (tt.wantStatus && i == 0) {
+					t.Errorf("call %d error = %v, want http status error %v", i, err, tt.wantStatus && i == 0)
+					continue
+				}
+
+				if code := wework.ErrorCode(err); code != want {
+					t.Errorf("call %d errcode = %d, want %d", i, code, want)
+				}
+			}
+
+			if n := srv.Calls("/cgi-bin/department/get"); n != len(tt.wantErrs) {
+				t.Errorf("department/get calls = %d, want %d", n, len(tt.wantErrs))
+			}
+
+			if n := srv.Calls(""); n != len(tt.wantErrs)+1 {
+				t.Errorf("calls = %d, want %d", n, len(tt.wantErrs)+1)
+			}
+
+			srv.ClearFaults()
+			if _, err := c.GetDepartment(wework.RootDepartmentID); err != nil {
+				t.Errorf("GetDepartment after ClearFaults error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLatency(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	c := srv.Client()
+	defer c.Close()
+
+	srv.SetLatency(50 * time.Millisecond)
+
+	start := time.Now()
+	if _, err := c.GetDepartment(wework.RootDepartmentID); err != nil {
+		t.Fatalf("GetDepartment error: %v", err)
+	}
+
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("token and department fetch took %v, want at least 100ms", d)
+	}
+}
+
+func TestCodes(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	srv.AddUser(wework.User{UserID: "zhangsan", Name: "张三", Department: []int{1}})
+
+	c := srv.Client()
+	defer c.Close()
+
+	tests := []struct {
+		name       string
+		code       string
+		wantUserID string
+		wantOpenID string
+		wantCode   int
+	}{
+		{"member", srv.Code("zhangsan"), "zhangsan", "", wework.ErrCodeOK},
+		{"non-member", srv.Code("lisi"), "", "open-lisi", wework.ErrCodeOK},
+		{"unknown code", "bogus", "", "", wework.ErrCodeInvalidCode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := c.Authenticate(tt.code)
+			if code := wework.ErrorCode(err); code != tt.wantCode {
+				t.Fatalf("Authenticate errcode = %d, want %d. err: %v", code, tt.wantCode, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if info.UserID != tt.wantUserID || info.OpenID != tt.wantOpenID {
+				t.Errorf("Authenticate = %q, %q, want %q, %q", info.UserID, info.OpenID, tt.wantUserID, tt.wantOpenID)
+			}
+
+			if _, err := c.Authenticate(tt.code); wework.ErrorCode(err) != wework.ErrCodeInvalidCode {
+				t.Errorf("reused code error = %v, want errcode %d", err, wework.ErrCodeInvalidCode)
+			}
+		})
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	srv.AddDepartment(wework.Department{ID: 2, Name: "Engineering", ParentID: 1})
+	srv.AddDepartment(wework.Department{ID: 3, Name: "Platform", ParentID: 2})
+	srv.AddUser(wework.User{UserID: "a", Department: []int{1}})
+	srv.AddUser(wework.User{UserID: "b", Department: []int{2}})
+	srv.AddUser(wework.User{UserID: "c", Department: []int{3}})
+	srv.AddUser(wework.User{UserID: "d", Department: []int{3}})
+	srv.RemoveUser("d")
+
+	c := srv.Client()
+	defer c.Close()
+
+	tests := []struct {
+		deptID    int
+		recursive bool
+		want      []string
+	}{
+		{1, false, []string{"a"}},
+		{1, true, []string{"a", "b", "c"}},
+		{2, true, []string{"b", "c"}},
+		{3, false, []string{"c"}},
+	}
+
+	for _, tt := range tests {
+		users, err := c.ListUsersByDepartment(tt.deptID, tt.recursive, false).All()
+		if err != nil {
+			t.Fatalf("ListUsersByDepartment error: %v", err)
+		}
+
+		var got []string
+		for _, u := range users {
+			got = append(got, u.UserID)
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ListUsersByDepartment(%d, %v) = %v, want %v", tt.deptID, tt.recursive, got, tt.want)
+		}
+	}
+
+	if _, err := c.ListUsersByDepartment(42, false, false).All(); wework.ErrorCode(err) != wework.ErrCodeDeptNotFound {
+		t.Errorf("ListUsersByDepartment of missing department error = %v, want errcode %d", err, wework.ErrCodeDeptNotFound)
+	}
+}
+
+func TestMessagesAndApprovals(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	srv.AddUser(wework.User{UserID: "zhangsan", Department: []int{1}})
+
+	c := srv.Client()
+	defer c.Close()
+
+	msg := wework.NewTextMessage("hello", "zhangsan")
+	if _, err := c.SendMessage(msg); err != nil {
+		t.Fatalf("SendMessage error: %v", err)
+	}
+
+	if msgs := srv.Messages(); len(msgs) != 1 || msgs[0].ToUser != "zhangsan" {
+		t.Errorf("Messages = %+v, want the message to zhangsan", msgs)
+	}
+
+	if _, err := c.ApplyEvent(&wework.ApplyEventRequest{CreatorUserID: "lisi", TemplateID: "tpl"}); wework.ErrorCode(err) != wework.ErrCodeInvalidUserID {
+		t.Errorf("ApplyEvent by non-member error = %v, want errcode %d", err, wework.ErrCodeInvalidUserID)
+	}
+
+	resp, err := c.ApplyEvent(&wework.ApplyEventRequest{CreatorUserID: "zhangsan", TemplateID: "tpl"})
+	if err != nil {
+		t.Fatalf("ApplyEvent error: %v", err)
+	}
+
+	if req := srv.Approval(resp.SpNo); req == nil || req.TemplateID != "tpl" {
+		t.Errorf("Approval = %+v, want the request of template tpl", req)
+	}
+
+	tests := []struct {
+		set  wework.ApprovalStatus
+		want wework.ApprovalStatus
+	}{
+		{0, wework.ApprovalPending},
+		{wework.ApprovalApproved, wework.ApprovalApproved},
+	}
+
+	for _, tt := range tests {
+		if tt.set != 0 {
+			srv.SetApprovalStatus(resp.SpNo, tt.set)
+		}
+
+		detail, err := c.GetApprovalDetail(resp.SpNo)
+		if err != nil {
+			t.Fatalf("GetApprovalDetail error: %v", err)
+		}
+
+		if detail.Info.SpStatus != tt.want || detail.Info.Applyer.UserID != "zhangsan" {
+			t.Errorf("GetApprovalDetail = %+v, want status %v by zhangsan", detail.Info, tt.want)
+		}
+	}
+}
+
+func getCode(t *testing.T, url string) int {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	var body struct {
+		Code int `json:"errcode"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	return body.Code
+}
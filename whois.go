@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/pragkent/hydra-wework/server"
+)
+
+// whois prints the claims a user would be issued on sign-in, or why it would
+// be denied.
+func whois(cfg *server.Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Usage: hydra-wework [flags] whois <userid|email|mobile>")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("Config validate error: %v", err)
+	}
+
+	srv, err := server.New(cfg)
+	if err != nil {
+		return err
+	}
+
+	defer srv.Close()
+
+	result, err := srv.Whois(context.Background(), args[0])
+	if err != nil {
+		return fmt.Errorf("Whois failed: %v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}